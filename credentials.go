@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+)
+
+// Credentials gives the scripts access to the credentials passed to the
+// function pipeline step. The credentials aren't included in the request map
+// as is, so the secrets don't leak when the request is logged by the scripts.
+type Credentials struct {
+	req *fnv1.RunFunctionRequest
+}
+
+// NewCredentials creates the Credentials object available to the JavaScript
+// handler function as request.credentials.
+func NewCredentials(req *fnv1.RunFunctionRequest) *Credentials {
+	return &Credentials{req: req}
+}
+
+// Get returns the decoded data of the credentials with the specified name.
+func (c *Credentials) Get(name string) (map[string]string, error) {
+	creds, err := request.GetCredentials(c.req, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get credentials %q", name)
+	}
+
+	data := make(map[string]string, len(creds.Data))
+	for key, val := range creds.Data {
+		data[key] = string(val)
+	}
+
+	return data, nil
+}
+
+// Names returns the sorted names of the available credentials.
+func (c *Credentials) Names() []string {
+	names := make([]string, 0, len(c.req.GetCredentials()))
+	for name := range c.req.GetCredentials() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// MarshalJSON redacts the credentials data, so JSON.stringify(request) only
+// shows the names of the available credentials.
+func (c *Credentials) MarshalJSON() ([]byte, error) {
+	redacted := make(map[string]string, len(c.req.GetCredentials()))
+	for name := range c.req.GetCredentials() {
+		redacted[name] = "<redacted>"
+	}
+
+	return json.Marshal(redacted)
+}
@@ -3,28 +3,41 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"strings"
+	"time"
 
 	"github.com/salemove/crossplane-function-javascript/input/v1beta1"
 	"github.com/salemove/crossplane-function-javascript/internal/js"
+	"github.com/salemove/crossplane-function-javascript/internal/scripts"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 
 	"github.com/crossplane/crossplane-runtime/pkg/errors"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
-	fnv1beta1 "github.com/crossplane/function-sdk-go/proto/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
 	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/response"
 )
 
 // Function returns whatever response you ask it to.
 type Function struct {
-	fnv1beta1.UnimplementedFunctionRunnerServiceServer
-
-	log logging.Logger
+	fnv1.UnimplementedFunctionRunnerServiceServer
+
+	log      logging.Logger
+	scripts  *scripts.Dir
+	oci      *scripts.OCI
+	programs *js.ProgramCache
+	runtimes *js.Pool
+	timeout  time.Duration
+
+	memoryLimit      uint64
+	maxStringLength  int
+	maxArrayLength   int
+	maxCallStackSize int
 }
 
 // RunFunction runs the Function.
-func (f *Function) RunFunction(_ context.Context, req *fnv1beta1.RunFunctionRequest) (*fnv1beta1.RunFunctionResponse, error) {
+func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, error) {
 	f.log.Info("Running function", "tag", req.GetMeta().GetTag())
 
 	rsp := response.To(req, response.DefaultTTL)
@@ -35,9 +48,21 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1beta1.RunFunctionRequ
 		return rsp, nil
 	}
 
-	source := strings.TrimSpace(in.Spec.Source.Inline)
-	if source == "" {
-		response.Fatal(rsp, errors.New("invalid function input: empty source"))
+	if in.Spec.TTL != nil {
+		if in.Spec.TTL.Duration < 0 {
+			response.Fatal(rsp, errors.Errorf("invalid TTL %s: must be a non-negative duration", in.Spec.TTL.Duration))
+			return rsp, nil
+		}
+		rsp.Meta.Ttl = durationpb.New(in.Spec.TTL.Duration)
+	}
+
+	source, err := f.getSource(ctx, req, in, rsp)
+	if errors.Is(err, errSourceNotReady) {
+		f.log.Debug("Waiting for the function source", "tag", req.GetMeta().GetTag())
+		return rsp, nil
+	}
+	if err != nil {
+		response.Fatal(rsp, err)
 		return rsp, nil
 	}
 
@@ -53,15 +78,88 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1beta1.RunFunctionRequ
 		return rsp, nil
 	}
 
+	values, err := convertValues(in.Spec.Values)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return rsp, nil
+	}
+
 	transpile := true
 	if in.Spec.Source.Transpile != nil {
 		transpile = *in.Spec.Source.Transpile
 	}
 
-	runtime := js.NewRuntime()
-	script := runtime.Script("<inline.js>", source, reqObj, respObj)
-	_, err = script.Run(js.TranspileToES5(transpile))
-	if err != nil {
+	// The types of TypeScript sources are stripped by esbuild.
+	transpiler := in.Spec.Source.Transpiler
+	if transpiler == "" && in.Spec.Source.Language == v1beta1.LanguageTypeScript {
+		transpiler = v1beta1.TranspilerESBuild
+	}
+
+	var runtime *js.Runtime
+	if f.runtimes != nil {
+		runtime = f.runtimes.Get()
+		defer f.runtimes.Put(runtime)
+	} else {
+		runtime = js.NewRuntime()
+	}
+
+	script := runtime.Script(source.Name, source.Code, reqObj, respObj, values)
+	// The input timeout can only shorten the function timeout, so a Composition can't disable it.
+	timeout := f.timeout
+	if in.Spec.Timeout != nil {
+		if in.Spec.Timeout.Duration <= 0 {
+			response.Fatal(rsp, errors.Errorf("invalid timeout %s: must be positive", in.Spec.Timeout.Duration))
+			return rsp, nil
+		}
+		if timeout <= 0 || in.Spec.Timeout.Duration < timeout {
+			timeout = in.Spec.Timeout.Duration
+		}
+	}
+
+	scriptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		scriptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	opts := []js.ScriptOption{
+		js.TranspileToES5(transpile),
+		js.WithTranspiler(js.Transpiler(transpiler)),
+		js.WithLanguage(js.Language(in.Spec.Source.Language)),
+		js.WithModules(in.Spec.Source.Modules),
+		js.WithContext(scriptCtx),
+		js.WithMemoryLimit(f.memoryLimit),
+		js.WithMaxStringLength(f.maxStringLength),
+		js.WithMaxArrayLength(f.maxArrayLength),
+		js.WithMaxCallStackSize(f.maxCallStackSize),
+	}
+	if f.programs != nil {
+		opts = append(opts, js.WithProgramCache(f.programs))
+	}
+
+	_, err = script.Run(opts...)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil:
+		// The deadline of the function call has expired before the script timeout.
+		response.Fatal(rsp, errors.Errorf("function error: script %q timed out: the deadline of the function call was exceeded", source.Name))
+		return rsp, nil
+	case errors.Is(err, context.DeadlineExceeded):
+		response.Fatal(rsp, errors.Errorf("function error: script %q timed out after %s", source.Name, timeout))
+		return rsp, nil
+	case errors.Is(err, js.ErrMemoryLimitExceeded):
+		response.Fatal(rsp, errors.Errorf("function error: script %q was stopped: memory limit exceeded", source.Name))
+		return rsp, nil
+	case errors.Is(err, js.ErrMaxStringLengthExceeded):
+		response.Fatal(rsp, errors.Errorf("function error: script %q was stopped: maximum string length exceeded", source.Name))
+		return rsp, nil
+	case errors.Is(err, js.ErrMaxArrayLengthExceeded):
+		response.Fatal(rsp, errors.Errorf("function error: script %q was stopped: maximum array length exceeded", source.Name))
+		return rsp, nil
+	case errors.Is(err, context.Canceled):
+		response.Fatal(rsp, errors.Errorf("function error: script %q was cancelled", source.Name))
+		return rsp, nil
+	case err != nil:
 		response.Fatal(rsp, errors.Wrap(err, "function error"))
 		return rsp, nil
 	}
@@ -72,7 +170,7 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1beta1.RunFunctionRequ
 	return rsp, nil
 }
 
-func convertToMap(req *fnv1beta1.RunFunctionRequest) (map[string]any, error) {
+func convertToMap(req *fnv1.RunFunctionRequest) (map[string]any, error) {
 	jReq, err := protojson.Marshal(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot marshal request from proto to json")
@@ -83,5 +181,23 @@ func convertToMap(req *fnv1beta1.RunFunctionRequest) (map[string]any, error) {
 		return nil, errors.Wrap(err, "cannot unmarshal json to map[string]any")
 	}
 
+	// The credentials are replaced with the object redacting the secrets.
+	mReq["credentials"] = NewCredentials(req)
+
 	return mReq, nil
 }
+
+// convertValues decodes the input values into plain Go values, so that
+// strings, numbers, objects, etc. are passed to the handler as is.
+func convertValues(in map[string]extv1.JSON) (map[string]any, error) {
+	values := make(map[string]any, len(in))
+	for key, val := range in {
+		var v any
+		if err := json.Unmarshal(val.Raw, &v); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal value %q", key)
+		}
+		values[key] = v
+	}
+
+	return values, nil
+}
@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/salemove/crossplane-function-javascript/internal/js"
+	"github.com/salemove/crossplane-function-javascript/internal/scripts"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/function-sdk-go"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
 	fnv1beta1 "github.com/crossplane/function-sdk-go/proto/v1beta1"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/response"
@@ -25,10 +31,10 @@ func TestRunFunction(t *testing.T) {
 
 	type args struct {
 		ctx context.Context
-		req *fnv1beta1.RunFunctionRequest
+		req *fnv1.RunFunctionRequest
 	}
 	type want struct {
-		rsp *fnv1beta1.RunFunctionResponse
+		rsp *fnv1.RunFunctionResponse
 		err error
 	}
 
@@ -40,17 +46,18 @@ func TestRunFunction(t *testing.T) {
 		"EmptySource": {
 			reason: "The Function should return a fatal result if no input was specified",
 			args: args{
-				req: &fnv1beta1.RunFunctionRequest{
-					Meta:  &fnv1beta1.RequestMeta{Tag: "hello"},
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
 					Input: scriptToInput(""),
 				},
 			},
 			want: want{
-				rsp: &fnv1beta1.RunFunctionResponse{
-					Meta: &fnv1beta1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Results: []*fnv1beta1.Result{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
 						{
-							Severity: fnv1beta1.Severity_SEVERITY_FATAL,
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 							Message:  "invalid function input: empty source",
 						},
 					},
@@ -60,26 +67,26 @@ func TestRunFunction(t *testing.T) {
 		"EmptyFunctionResponse": {
 			reason: "The Function should return a normal result",
 			args: args{
-				req: &fnv1beta1.RunFunctionRequest{
-					Meta:  &fnv1beta1.RequestMeta{Tag: "hello"},
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
 					Input: scriptToInput("export default (req, rsp) => {};"),
-					Observed: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
-					Desired: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
 				},
 			},
 			want: want{
-				rsp: &fnv1beta1.RunFunctionResponse{
-					Meta: &fnv1beta1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Desired: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
@@ -89,8 +96,8 @@ func TestRunFunction(t *testing.T) {
 		"BasicResource": {
 			reason: "The Function should return a normal result",
 			args: args{
-				req: &fnv1beta1.RunFunctionRequest{
-					Meta: &fnv1beta1.RequestMeta{Tag: "hello"},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
 					Input: scriptToInput(`export default (req, rsp) => {
 						rsp.setDesiredComposedResource("test", {
 							apiVersion: 'example.org/v1',
@@ -103,28 +110,28 @@ func TestRunFunction(t *testing.T) {
 							}
 						})
 					};`),
-					Observed: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
-					Desired: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
 				},
 			},
 			want: want{
-				rsp: &fnv1beta1.RunFunctionResponse{
-					Meta: &fnv1beta1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Desired: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
-						Resources: map[string]*fnv1beta1.Resource{
+						Resources: map[string]*fnv1.Resource{
 							"test": {
-								Ready: fnv1beta1.Ready_READY_TRUE,
+								Ready: fnv1.Ready_READY_TRUE,
 								Resource: resource.MustStructJSON(`{
 									"apiVersion":"example.org/v1",
 									"kind":"Bucket",
@@ -142,8 +149,8 @@ func TestRunFunction(t *testing.T) {
 		"ConnectionDetails": {
 			reason: "The Function should return a normal result",
 			args: args{
-				req: &fnv1beta1.RunFunctionRequest{
-					Meta: &fnv1beta1.RequestMeta{Tag: "hello"},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
 					Input: scriptToInput(`export default (req, rsp) => {
 						rsp.setDesiredComposedResource("test", {
 							apiVersion: 'example.org/v1',
@@ -154,27 +161,27 @@ func TestRunFunction(t *testing.T) {
 						});
 						rsp.setConnectionDetails({ key: btoa('value') });
 					};`),
-					Observed: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
-					Desired: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(xr),
 						},
 					},
 				},
 			},
 			want: want{
-				rsp: &fnv1beta1.RunFunctionResponse{
-					Meta: &fnv1beta1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Desired: &fnv1beta1.State{
-						Composite: &fnv1beta1.Resource{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
 							Resource:          resource.MustStructJSON(xr),
 							ConnectionDetails: map[string][]byte{"key": []byte("value")},
 						},
-						Resources: map[string]*fnv1beta1.Resource{
+						Resources: map[string]*fnv1.Resource{
 							"test": {
 								Resource: resource.MustStructJSON(`{
 									"apiVersion":"example.org/v1",
@@ -189,12 +196,1508 @@ func TestRunFunction(t *testing.T) {
 				},
 			},
 		},
+		"Values": {
+			reason: "The Function should pass input values to the handler as the third argument",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": `export default (req, rsp, values) => {
+								rsp.updateCompositeStatus({
+									region: values.region,
+									replicas: values.replicas,
+									tags: values.tags
+								});
+							};`,
+						},
+						"values": map[string]interface{}{
+							"region":   "eu-west-1",
+							"replicas": 3,
+							"tags":     map[string]interface{}{"team": "platform"},
+						},
+					}),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"spec":{"region":"us-east-1"},
+								"status":{"region":"eu-west-1","replicas":3,"tags":{"team":"platform"}}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"ConfigMapSourceRequirements": {
+			reason: "The Function should request the source ConfigMap as an extra resource",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"type": "ConfigMap",
+							"configMap": map[string]interface{}{
+								"matchLabels": map[string]interface{}{"app": "function"},
+								"key":         "main.js",
+							},
+						},
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Requirements: &fnv1.Requirements{
+						ExtraResources: map[string]*fnv1.ResourceSelector{
+							ExtraResourcesSourceKey: {
+								ApiVersion: "v1",
+								Kind:       "ConfigMap",
+								Match: &fnv1.ResourceSelector_MatchLabels{
+									MatchLabels: &fnv1.MatchLabels{Labels: map[string]string{"app": "function"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"ConfigMapSource": {
+			reason: "The Function should run the source from the ConfigMap supplied by Crossplane",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"type": "ConfigMap",
+							"configMap": map[string]interface{}{
+								"matchLabels": map[string]interface{}{"app": "function"},
+								"key":         "main.js",
+							},
+						},
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					ExtraResources: map[string]*fnv1.Resources{
+						ExtraResourcesSourceKey: {
+							Items: []*fnv1.Resource{
+								{
+									Resource: resource.MustStructJSON(`{
+										"apiVersion":"v1",
+										"kind":"ConfigMap",
+										"metadata":{"name":"function","namespace":"default","labels":{"app":"function"}},
+										"data":{"main.js":"export default (req, rsp) => { rsp.updateCompositeStatus({ ok: true }) }"}
+									}`),
+								},
+							},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"spec":{"region":"us-east-1"},
+								"status":{"ok":true}
+							}`),
+						},
+					},
+					Requirements: &fnv1.Requirements{
+						ExtraResources: map[string]*fnv1.ResourceSelector{
+							ExtraResourcesSourceKey: {
+								ApiVersion: "v1",
+								Kind:       "ConfigMap",
+								Match: &fnv1.ResourceSelector_MatchLabels{
+									MatchLabels: &fnv1.MatchLabels{Labels: map[string]string{"app": "function"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"ConfigMapSourceNotFound": {
+			reason: "The Function should return a fatal result if no ConfigMap matches the labels",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"type": "ConfigMap",
+							"configMap": map[string]interface{}{
+								"matchLabels": map[string]interface{}{"app": "function"},
+								"key":         "main.js",
+							},
+						},
+					}),
+					ExtraResources: map[string]*fnv1.Resources{
+						ExtraResourcesSourceKey: {},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  "cannot find the source ConfigMap matching the labels",
+						},
+					},
+					Requirements: &fnv1.Requirements{
+						ExtraResources: map[string]*fnv1.ResourceSelector{
+							ExtraResourcesSourceKey: {
+								ApiVersion: "v1",
+								Kind:       "ConfigMap",
+								Match: &fnv1.ResourceSelector_MatchLabels{
+									MatchLabels: &fnv1.MatchLabels{Labels: map[string]string{"app": "function"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"FileSource": {
+			reason: "The Function should run the source from the scripts directory",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"type": "File",
+							"file": "status.js",
+						},
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"spec":{"region":"us-east-1"},
+								"status":{"source":"file"}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"FileSourceOutsideScriptsDir": {
+			reason: "The Function should return a fatal result if the source file is outside the scripts directory",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"type": "File",
+							"file": "../fn.go",
+						},
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `cannot load the source file: invalid script path "../fn.go": must be relative to the scripts directory`,
+						},
+					},
+				},
+			},
+		},
+		"Timeout": {
+			reason: "The Function should return a fatal result if the script times out",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": "export default () => { while (true) {} };",
+						},
+						"timeout": "100ms",
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `function error: script "<inline.js>" timed out after 100ms`,
+						},
+					},
+				},
+			},
+		},
+		"TimeoutAboveFunctionTimeout": {
+			reason: "The Function should not let the input timeout exceed the function timeout",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": "export default () => { while (true) {} };",
+						},
+						"timeout": "1h",
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `function error: script "<inline.js>" timed out after 500ms`,
+						},
+					},
+				},
+			},
+		},
+		"TimeoutNotPositive": {
+			reason: "The Function should return a fatal result if the input timeout isn't positive",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": "export default () => { while (true) {} };",
+						},
+						"timeout": "0s",
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `invalid timeout 0s: must be positive`,
+						},
+					},
+				},
+			},
+		},
+		"RequestDeadline": {
+			reason: "The Function should return a fatal result naming the request deadline if it expires first",
+			args: args{
+				ctx: func() context.Context {
+					ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+					time.AfterFunc(time.Second, cancel)
+					return ctx
+				}(),
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput("export default () => { while (true) {} };"),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `function error: script "<inline.js>" timed out: the deadline of the function call was exceeded`,
+						},
+					},
+				},
+			},
+		},
+		"Cancelled": {
+			reason: "The Function should return a fatal result if the request is cancelled",
+			args: args{
+				ctx: func() context.Context {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+					return ctx
+				}(),
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput("export default () => { while (true) {} };"),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `function error: script "<inline.js>" was cancelled`,
+						},
+					},
+				},
+			},
+		},
+		"MaxStringLength": {
+			reason: "The Function should return a fatal result if the script exceeds the maximum string length",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput("export default () => 'x'.repeat(1001);"),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `function error: script "<inline.js>" was stopped: maximum string length exceeded`,
+						},
+					},
+				},
+			},
+		},
+		"MaxArrayLength": {
+			reason: "The Function should return a fatal result if the script exceeds the maximum array length",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput("export default () => { const a = []; while (true) { a.push(1) } };"),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  `function error: script "<inline.js>" was stopped: maximum array length exceeded`,
+						},
+					},
+				},
+			},
+		},
+		"MaxCallStackSize": {
+			reason: "The Function should return a fatal result if the script exceeds the maximum call stack size",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput("exports.default = function f() { return f() };"),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message: "function error: maximum call stack size exceeded" +
+								strings.Repeat("\n    at f (<inline.js>:1:43)", 10) +
+								"\n    ... 91 more\n\n" +
+								"> 1 | exports.default = function f() { return f() };\n" +
+								"    |                                           ^",
+						},
+					},
+				},
+			},
+		},
+		"ScriptErrorCodeFrame": {
+			reason: "The Function should return a fatal result with the original stack trace and the code frame if the script throws an error",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta:  &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput("export default function handler(req, rsp) {\n  throw new Error(`cannot handle ${req.meta.tag}`);\n}\n"),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message: "function error: Error: cannot handle hello\n" +
+								"    at handler (<inline.js>:2:9)\n\n" +
+								"  1 | export default function handler(req, rsp) {\n" +
+								"> 2 |   throw new Error(`cannot handle ${req.meta.tag}`);\n" +
+								"    |         ^\n" +
+								"  3 | }",
+						},
+					},
+				},
+			},
+		},
+		"ESBuildModules": {
+			reason: "The Function should bundle the source with the input modules using esbuild",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"transpiler": "ESBuild",
+							"inline": `import { greet } from "./lib/greet";
+								export default (req, rsp) => rsp.normal(greet(req.meta.tag));`,
+							"modules": map[string]interface{}{
+								"lib/greet.ts": `export const greet = (name: string): string => ` + "`Hello, ${name}!`",
+							},
+						},
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "Hello, hello!",
+						},
+					},
+				},
+			},
+		},
+		"ModulesRequireESBuild": {
+			reason: "The Function should return a fatal result if the modules are used without the ESBuild transpiler",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": `import { one } from "./lib"; export default () => {};`,
+							"modules": map[string]interface{}{
+								"lib.js": `export const one = 1;`,
+							},
+						},
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  "function error: modules are only supported by the ESBuild transpiler",
+						},
+					},
+				},
+			},
+		},
+		"TypeScript": {
+			reason: "The Function should strip the types of the TypeScript source before running it",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"language": "typescript",
+							"inline": `interface Meta { tag: string }
+								const greet = (meta: Meta): string => ` + "`Hello, ${meta.tag}!`" + `;
+								export default (req: { meta: Meta }, rsp: any): void => rsp.normal(greet(req.meta));`,
+						},
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "Hello, hello!",
+						},
+					},
+				},
+			},
+		},
+		"TypeScriptWithoutTranspilation": {
+			reason: "The Function should return a fatal result if the TypeScript source transpilation is disabled",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"language":  "typescript",
+							"transpile": false,
+							"inline":    `export default (req: any, rsp: any): void => {};`,
+						},
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  "function error: TypeScript sources are only supported by the ESBuild transpiler",
+						},
+					},
+				},
+			},
+		},
+		"Results": {
+			reason: "The Function should return the results emitted by the script",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.normal('normal');
+						rsp.warning('warning');
+						rsp.fatal('fatal');
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "normal",
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "warning",
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "fatal",
+						},
+					},
+				},
+			},
+		},
+		"Context": {
+			reason: "The Function should set the pipeline context keys and merge the environment",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.setContext('example.org/computed', { zones: ['a', 'b'], count: 2 });
+						rsp.mergeEnvironment({ region: 'eu-west-1', network: { cidr: '10.0.0.0/16' } });
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Context: resource.MustStructJSON(`{
+						"example.org/existing": "value",
+						"apiextensions.crossplane.io/environment": {
+							"apiVersion": "internal.crossplane.io/v1alpha1",
+							"kind": "Environment",
+							"region": "us-east-1",
+							"network": { "name": "default" }
+						}
+					}`),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Context: resource.MustStructJSON(`{
+						"example.org/existing": "value",
+						"example.org/computed": { "zones": ["a", "b"], "count": 2 },
+						"apiextensions.crossplane.io/environment": {
+							"apiVersion": "internal.crossplane.io/v1alpha1",
+							"kind": "Environment",
+							"region": "eu-west-1",
+							"network": { "name": "default", "cidr": "10.0.0.0/16" }
+						}
+					}`),
+				},
+			},
+		},
+		"RequireResources": {
+			reason: "The Function should request the extra resources required by the script",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.requireResources('vpc', { apiVersion: 'ec2.aws.upbound.io/v1beta1', kind: 'VPC', matchName: 'main' });
+						rsp.requireResources('subnets', { apiVersion: 'ec2.aws.upbound.io/v1beta1', kind: 'Subnet', matchLabels: { vpc: 'main' } });
+
+						const vpc = req.extraResources?.vpc?.items?.[0];
+						if (vpc) {
+							rsp.updateCompositeStatus({ vpcId: vpc.resource.status.atProvider.id });
+						}
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					ExtraResources: map[string]*fnv1.Resources{
+						"vpc": {
+							Items: []*fnv1.Resource{
+								{
+									Resource: resource.MustStructJSON(`{
+										"apiVersion":"ec2.aws.upbound.io/v1beta1",
+										"kind":"VPC",
+										"metadata":{"name":"main"},
+										"status":{"atProvider":{"id":"vpc-123"}}
+									}`),
+								},
+							},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"spec":{"region":"us-east-1"},
+								"status":{"vpcId":"vpc-123"}
+							}`),
+						},
+					},
+					Requirements: &fnv1.Requirements{
+						ExtraResources: map[string]*fnv1.ResourceSelector{
+							"vpc": {
+								ApiVersion: "ec2.aws.upbound.io/v1beta1",
+								Kind:       "VPC",
+								Match:      &fnv1.ResourceSelector_MatchName{MatchName: "main"},
+							},
+							"subnets": {
+								ApiVersion: "ec2.aws.upbound.io/v1beta1",
+								Kind:       "Subnet",
+								Match: &fnv1.ResourceSelector_MatchLabels{
+									MatchLabels: &fnv1.MatchLabels{Labels: map[string]string{"vpc": "main"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"RequireResourcesInvalidSelector": {
+			reason: "The Function should throw an error if the resource selector is invalid",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						try {
+							rsp.requireResources('vpc', { apiVersion: 'ec2.aws.upbound.io/v1beta1', kind: 'VPC' });
+						} catch (e) {
+							rsp.fatal(e.message);
+						}
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  `invalid resource selector "vpc": matchName or matchLabels must be set`,
+						},
+					},
+				},
+			},
+		},
+		"DesiredComposedResources": {
+			reason: "The Function should allow reading and deleting the desired composed resources",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						const bucket = rsp.getDesiredComposedResource('bucket');
+						bucket.spec.forProvider.region = 'eu-west-1';
+						rsp.setDesiredComposedResource('bucket', bucket);
+						rsp.deleteDesiredComposedResource('queue');
+
+						rsp.updateCompositeStatus({
+							resources: rsp.listDesiredComposedResources(),
+							missing: rsp.getDesiredComposedResource('queue'),
+						});
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"bucket": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Bucket",
+									"spec":{"forProvider":{"region":"us-east-1"}}
+								}`),
+							},
+							"queue": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Queue"
+								}`),
+							},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"spec":{"region":"us-east-1"},
+								"status":{"resources":["bucket"],"missing":null}
+							}`),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"bucket": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Bucket",
+									"spec":{"forProvider":{"region":"eu-west-1"}}
+								}`),
+							},
+						},
+					},
+				},
+			},
+		},
+		"MergeAndPatchDesiredComposedResources": {
+			reason: "The Function should merge and patch the desired composed resources keeping the existing fields",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.mergeDesiredComposedResource('bucket', {
+							spec: { forProvider: { versioning: false, tags: { team: 'platform' } } }
+						});
+						rsp.patchDesiredComposedResource('queue', [
+							{ op: 'replace', path: '/spec/forProvider/region', value: 'eu-west-1' },
+							{ op: 'remove', path: '/spec/forProvider/delay' },
+						]);
+						rsp.mergeDesiredComposedResource('topic', { apiVersion: 'example.org/v1', kind: 'Topic' });
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"bucket": {
+								Ready: fnv1.Ready_READY_TRUE,
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Bucket",
+									"spec":{"forProvider":{"region":"us-east-1","versioning":true,"tags":{"env":"prod"}}}
+								}`),
+							},
+							"queue": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Queue",
+									"spec":{"forProvider":{"region":"us-east-1","delay":10}}
+								}`),
+							},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"bucket": {
+								Ready: fnv1.Ready_READY_TRUE,
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Bucket",
+									"spec":{"forProvider":{"region":"us-east-1","versioning":false,"tags":{"env":"prod","team":"platform"}}}
+								}`),
+							},
+							"queue": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Queue",
+									"spec":{"forProvider":{"region":"eu-west-1"}}
+								}`),
+							},
+							"topic": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Topic"
+								}`),
+							},
+						},
+					},
+				},
+			},
+		},
+		"PatchMissingDesiredComposedResource": {
+			reason: "The Function should throw an error if the patched resource doesn't exist",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						try {
+							rsp.patchDesiredComposedResource('queue', [{ op: 'remove', path: '/spec' }]);
+						} catch (e) {
+							rsp.fatal(e.message);
+						}
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  `cannot patch resource "queue": resource not found`,
+						},
+					},
+				},
+			},
+		},
+		"DesiredComposite": {
+			reason: "The Function should set the desired composite resource metadata, status and readiness",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.setCompositeLabels({ team: 'platform', obsolete: null });
+						rsp.setCompositeAnnotations({ 'example.org/owner': 'ops' });
+						rsp.setCompositeStatus('network', { vpcId: 'vpc-1' });
+						rsp.setCompositeStatus('legacy', null);
+						rsp.mergeCompositeStatus('database', { ready: true });
+						rsp.setCompositeReady('False');
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"metadata":{"labels":{"env":"prod","obsolete":"yes"}},
+								"status":{"network":{"subnetId":"subnet-1"},"database":{"host":"db"},"legacy":true}
+							}`),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Ready: fnv1.Ready_READY_FALSE,
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"metadata":{
+									"labels":{"env":"prod","team":"platform"},
+									"annotations":{"example.org/owner":"ops"}
+								},
+								"status":{"network":{"vpcId":"vpc-1"},"database":{"host":"db","ready":true}}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidCompositeReadiness": {
+			reason: "The Function should throw an error if the composite readiness is invalid",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						try {
+							rsp.setCompositeReady('Yes');
+						} catch (e) {
+							rsp.fatal(e.message);
+						}
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  `invalid desired composite readiness: invalid readiness value "Yes", expected one of: True, False, Unspecified`,
+						},
+					},
+				},
+			},
+		},
+		"Readiness": {
+			reason: "The Function should set the readiness of the desired composed resources",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.setDesiredComposedResource('bucket', { apiVersion: 'example.org/v1', kind: 'Bucket' }, { ready: true });
+						rsp.setDesiredComposedResource('queue', {
+							apiVersion: 'example.org/v1',
+							kind: 'Queue',
+							metadata: { annotations: { 'javascript.fn.crossplane.io/ready': 'True' } }
+						}, { ready: 'False' });
+						rsp.setDesiredComposedResource('topic', { apiVersion: 'example.org/v1', kind: 'Topic' });
+						rsp.setReady('topic', 'True');
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"bucket": {
+								Ready:    fnv1.Ready_READY_TRUE,
+								Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`),
+							},
+							"queue": {
+								Ready:    fnv1.Ready_READY_FALSE,
+								Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Queue","metadata":{"annotations":{}}}`),
+							},
+							"topic": {
+								Ready:    fnv1.Ready_READY_TRUE,
+								Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Topic"}`),
+							},
+						},
+					},
+				},
+			},
+		},
+		"InvalidReadiness": {
+			reason: "The Function should throw an error if the readiness is invalid",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						const bucket = {
+							apiVersion: 'example.org/v1',
+							kind: 'Bucket',
+							metadata: { annotations: { 'javascript.fn.crossplane.io/ready': 'Yes' } }
+						};
+						for (const f of [
+							() => rsp.setDesiredComposedResource('bucket', bucket),
+							() => rsp.setDesiredComposedResource('queue', { apiVersion: 'example.org/v1', kind: 'Queue' }, { ready: 1 }),
+							() => rsp.setReady('topic', 'True'),
+						]) {
+							try {
+								f();
+							} catch (e) {
+								rsp.warning(e.message);
+							}
+						}
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `invalid resource "bucket": invalid javascript.fn.crossplane.io/ready annotation: invalid readiness value "Yes", expected one of: True, False, Unspecified`,
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `invalid resource "queue": invalid readiness value of type int64, expected a boolean or a string`,
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `cannot set readiness of resource "topic": resource not found`,
+						},
+					},
+				},
+			},
+		},
+		"ConnectionDetailsEncoding": {
+			reason: "The Function should set plain and binary connection details",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.setConnectionDetails({ username: 'admin', password: 's3cr3t' }, { encoding: 'plain' });
+						rsp.setConnectionDetails({
+							key: new Uint8Array([1, 2, 3]),
+							cert: new Uint8Array([4, 5]).buffer,
+						});
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+							ConnectionDetails: map[string][]byte{
+								"username": []byte("admin"),
+								"password": []byte("s3cr3t"),
+								"key":      {1, 2, 3},
+								"cert":     {4, 5},
+							},
+						},
+					},
+				},
+			},
+		},
+		"InvalidConnectionDetails": {
+			reason: "The Function should throw an error naming the key if a connection details value is invalid",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						for (const f of [
+							() => rsp.setConnectionDetails({ username: btoa('admin'), password: 'not base64!' }),
+							() => rsp.setConnectionDetails({ port: 5432 }),
+							() => rsp.setConnectionDetails({ username: 'admin' }, { encoding: 'hex' }),
+						]) {
+							try {
+								f();
+							} catch (e) {
+								rsp.warning(e.message);
+							}
+						}
+					};`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `invalid connection details "password": cannot decode Base64 value: illegal base64 data at input byte 3`,
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `invalid connection details "port": expected a string or binary value, got int64`,
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `invalid connection details encoding "hex", expected one of: base64, plain`,
+						},
+					},
+				},
+			},
+		},
+		"ComposedConnectionDetailsAndReadinessChecks": {
+			reason: "The Function should propagate the composed resource connection details and check the readiness",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						for (const name of ['db', 'user', 'queue']) {
+							rsp.setDesiredComposedResource(name, { apiVersion: 'example.org/v1', kind: 'Resource' }, { ready: true });
+						}
+						rsp.propagateConnectionDetails('db', ['host', 'port']);
+						rsp.propagateConnectionDetails('user', { username: 'user', password: 'pass' });
+						rsp.setReadinessChecks('db', [
+							{ type: 'MatchCondition', matchCondition: { type: 'Ready', status: 'True' } },
+							{ type: 'NonEmpty', fieldPath: 'status.atProvider.endpoint' },
+						]);
+						rsp.setReadinessChecks('user', [{ type: 'MatchString', fieldPath: 'status.phase', matchString: 'Active' }]);
+						rsp.setReadinessChecks('queue', [{ type: 'MatchTrue', fieldPath: 'status.available' }]);
+						try {
+							rsp.setReadinessChecks('queue', [{ type: 'MatchTrue' }]);
+						} catch (e) {
+							rsp.warning(e.message);
+						}
+					};`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"db": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Resource",
+									"status":{
+										"atProvider":{"endpoint":"db.example.org"},
+										"conditions":[{"type":"Ready","status":"True"}]
+									}
+								}`),
+								ConnectionDetails: map[string][]byte{"host": []byte("db.example.org"), "ca": []byte("cert")},
+							},
+							"user": {
+								Resource:          resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Resource","status":{"phase":"Pending"}}`),
+								ConnectionDetails: map[string][]byte{"user": []byte("admin"), "pass": []byte("s3cr3t")},
+							},
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+							ConnectionDetails: map[string][]byte{
+								"host":     []byte("db.example.org"),
+								"username": []byte("admin"),
+								"password": []byte("s3cr3t"),
+							},
+						},
+						Resources: map[string]*fnv1.Resource{
+							"db": {
+								Ready:    fnv1.Ready_READY_TRUE,
+								Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Resource"}`),
+							},
+							"user": {
+								Ready:    fnv1.Ready_READY_FALSE,
+								Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Resource"}`),
+							},
+							"queue": {
+								Ready:    fnv1.Ready_READY_FALSE,
+								Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Resource"}`),
+							},
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `invalid readiness check 0 of resource "queue": fieldPath is required for MatchTrue check`,
+						},
+					},
+				},
+			},
+		},
+		"InputTTL": {
+			reason: "The Function should set the response TTL from the input",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": `export default (req, rsp) => {};`,
+						},
+						"ttl": "10m",
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(10 * time.Minute)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+		},
+		"NegativeInputTTL": {
+			reason: "The Function should return a fatal result if the input TTL is negative",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": `export default (req, rsp) => {};`,
+						},
+						"ttl": "-1m",
+					}),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+							Message:  "invalid TTL -1m0s: must be a non-negative duration",
+						},
+					},
+				},
+			},
+		},
+		"ScriptTTL": {
+			reason: "The Function should set the response TTL from the script, overriding the input",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: specToInput(map[string]interface{}{
+						"source": map[string]interface{}{
+							"inline": `export default (req, rsp) => {
+								try {
+									rsp.setTTL(-1);
+								} catch (e) {
+									rsp.warning(e.message);
+								}
+								rsp.setTTL(1.5);
+							};`,
+						},
+						"ttl": "10m",
+					}),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(1500 * time.Millisecond)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "invalid TTL -1: must be a non-negative number of seconds",
+						},
+					},
+				},
+			},
+		},
+		"Credentials": {
+			reason: "The Function should expose the decoded credentials to the script, but not to JSON.stringify",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: scriptToInput(`export default (req, rsp) => {
+						rsp.updateCompositeStatus({
+							names: req.credentials.names(),
+							token: req.credentials.get('api').token,
+							json: JSON.parse(JSON.stringify(req)).credentials,
+						});
+						try {
+							req.credentials.get('missing');
+						} catch (e) {
+							rsp.warning(e.message);
+						}
+					};`),
+					Credentials: map[string]*fnv1.Credentials{
+						"api": {
+							Source: &fnv1.Credentials_CredentialData{
+								CredentialData: &fnv1.CredentialData{Data: map[string][]byte{"token": []byte("s3cr3t")}},
+							},
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion":"example.org/v1",
+								"kind":"XR",
+								"spec":{"region":"us-east-1"},
+								"status":{"names":["api"],"token":"s3cr3t","json":{"api":"<redacted>"}}
+							}`),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `cannot get credentials "missing": missing: credential not found`,
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			f := &Function{log: logging.NewNopLogger()}
-			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
+			f := &Function{
+				log:      logging.NewNopLogger(),
+				scripts:  scripts.NewDir("testdata/scripts"),
+				programs: js.NewProgramCache(10),
+				runtimes: js.NewPool(1),
+				timeout:  500 * time.Millisecond,
+
+				maxStringLength:  1000,
+				maxArrayLength:   1000,
+				maxCallStackSize: 100,
+			}
+			ctx := tc.args.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			rsp, err := f.RunFunction(ctx, tc.args.req)
 
 			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
 				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
@@ -207,16 +1710,80 @@ func TestRunFunction(t *testing.T) {
 	}
 }
 
+func TestRunFunctionBeta(t *testing.T) {
+	f := &Function{
+		log:      logging.NewNopLogger(),
+		programs: js.NewProgramCache(10),
+		runtimes: js.NewPool(1),
+	}
+
+	req := &fnv1beta1.RunFunctionRequest{
+		Meta: &fnv1beta1.RequestMeta{Tag: "hello"},
+		Input: scriptToInput(`export default (req, rsp) => {
+			rsp.setDesiredComposedResource('bucket', {
+				apiVersion: 'example.org/v1',
+				kind: 'Bucket',
+				spec: { forProvider: { region: req.observed.composite.resource.spec.region } }
+			}, { ready: true });
+			rsp.normal('done');
+		};`),
+		Observed: &fnv1beta1.State{
+			Composite: &fnv1beta1.Resource{
+				Resource: resource.MustStructJSON(xr),
+			},
+		},
+		Desired: &fnv1beta1.State{
+			Composite: &fnv1beta1.Resource{
+				Resource: resource.MustStructJSON(xr),
+			},
+		},
+	}
+
+	want := &fnv1beta1.RunFunctionResponse{
+		Meta: &fnv1beta1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+		Desired: &fnv1beta1.State{
+			Composite: &fnv1beta1.Resource{
+				Resource: resource.MustStructJSON(xr),
+			},
+			Resources: map[string]*fnv1beta1.Resource{
+				"bucket": {
+					Ready:    fnv1beta1.Ready_READY_TRUE,
+					Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket","spec":{"forProvider":{"region":"us-east-1"}}}`),
+				},
+			},
+		},
+		Results: []*fnv1beta1.Result{
+			{
+				Severity: fnv1beta1.Severity_SEVERITY_NORMAL,
+				Message:  "done",
+			},
+		},
+	}
+
+	rsp, err := function.ServeBeta(f).RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("function.ServeBeta(f).RunFunction(...): unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("The Function should serve v1beta1 requests\nfunction.ServeBeta(f).RunFunction(...): -want rsp, +got rsp:\n%s", diff)
+	}
+}
+
 func scriptToInput(script string) *structpb.Struct {
+	return specToInput(map[string]interface{}{
+		"source": map[string]interface{}{
+			"inline": script,
+		},
+	})
+}
+
+func specToInput(spec map[string]interface{}) *structpb.Struct {
 	return resource.MustStructObject(&unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "javascript.fn.glia-dev.com/v1beta1",
 			"kind":       "Input",
-			"spec": map[string]interface{}{
-				"source": map[string]interface{}{
-					"inline": script,
-				},
-			},
+			"spec":       spec,
 		},
 	})
 }
@@ -5,6 +5,7 @@
 package v1beta1
 
 import (
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,20 +28,90 @@ type InputSpec struct {
 	// Source is the function source spec
 	Source InputSource `json:"source"`
 
-	// Values is the map of string variables to be passed into the request context
-	Values map[string]string `json:"values,omitempty"`
+	// Values is the map of variables passed to the function handler as the
+	// third argument. Values can be strings or any other JSON values.
+	Values map[string]extv1.JSON `json:"values,omitempty"`
+
+	// Timeout is the maximum duration of the script execution. Must be positive.
+	// Defaults to the function timeout (see the `--timeout` function flag), and
+	// can't exceed it.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// TTL is the duration for which the function response can be cached.
+	// Crossplane runs the function again at the latest when the TTL expires.
+	// Must not be negative. Defaults to 1 minute. Scripts can override it with
+	// `rsp.setTTL`.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
 }
 
+// Supported function source types.
+const (
+	// SourceTypeInline is the source type for the function source specified
+	// inline in the function input.
+	SourceTypeInline = "Inline"
+
+	// SourceTypeConfigMap is the source type for the function source loaded
+	// from a ConfigMap.
+	SourceTypeConfigMap = "ConfigMap"
+
+	// SourceTypeFile is the source type for the function source loaded from
+	// a file in the function scripts directory.
+	SourceTypeFile = "File"
+
+	// SourceTypeOCI is the source type for the function source loaded from
+	// an OCI artifact.
+	SourceTypeOCI = "OCI"
+)
+
+// Supported transpilers of the function source.
+const (
+	// TranspilerBabel transpiles the function source to ES5.1 with Babel.
+	TranspilerBabel = "Babel"
+
+	// TranspilerESBuild transpiles the function source with esbuild, and
+	// bundles it with the modules imported by the source.
+	TranspilerESBuild = "ESBuild"
+)
+
+// Supported languages of the function source.
+const (
+	// LanguageJavaScript is the language of JavaScript function sources.
+	LanguageJavaScript = "javascript"
+
+	// LanguageTypeScript is the language of TypeScript function sources.
+	LanguageTypeScript = "typescript"
+)
+
 // InputSource defines function source parameters
 type InputSource struct {
-	// Type defines the input source type (currently, only `Inline` is supported).
-	// +kubebuilder:validation:Enum=Inline
+	// Type defines the input source type.
+	// +kubebuilder:validation:Enum=Inline;ConfigMap;File;OCI
 	// +kubebuilder:default:=Inline
 	Type string `json:"type,omitempty"`
 
 	// Inline is the inline form input of the function source
 	Inline string `json:"inline,omitempty"`
 
+	// ConfigMap selects the ConfigMap containing the function source.
+	// Required when the source type is `ConfigMap`.
+	ConfigMap *ConfigMapSource `json:"configMap,omitempty"`
+
+	// File is the path of the function source file, relative to the function
+	// scripts directory (see the `--scripts-dir` function flag).
+	// Required when the source type is `File`.
+	File string `json:"file,omitempty"`
+
+	// OCI references the OCI artifact containing the function source.
+	// Required when the source type is `OCI`.
+	OCI *OCISource `json:"oci,omitempty"`
+
+	// Language of the source. The types of TypeScript sources are stripped
+	// by the ESBuild transpiler before running the source, so TypeScript
+	// sources use the ESBuild transpiler, unless another one is specified.
+	// +kubebuilder:validation:Enum=javascript;typescript
+	// +kubebuilder:default:=javascript
+	Language string `json:"language,omitempty"`
+
 	// Transpile indicates that the source should be transpiled to ES5
 	// before executing. This allows using modern ES syntax features in
 	// composition functions without transpiling them before inlining into
@@ -48,4 +119,41 @@ type InputSource struct {
 	//
 	// +kubebuilder:default:=false
 	Transpile *bool `json:"transpile,omitempty"`
+
+	// Transpiler selects the tool transpiling the source. Babel transforms
+	// the modern syntax to ES5.1. ESBuild is much faster, supports TypeScript
+	// sources (with the `.ts` extension), and bundles the modules imported by
+	// the source. Defaults to ESBuild for TypeScript sources, and to Babel
+	// otherwise.
+	// +kubebuilder:validation:Enum=Babel;ESBuild
+	Transpiler string `json:"transpiler,omitempty"`
+
+	// Modules are the additional modules, which the source can import with
+	// relative imports, e.g. `import { helper } from "./lib"`, keyed by their
+	// paths relative to the source. The modules are bundled with the source,
+	// so they require the ESBuild transpiler.
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// ConfigMapSource selects a ConfigMap containing the function source. The
+// ConfigMap is requested from Crossplane as an extra resource.
+type ConfigMapSource struct {
+	// MatchLabels selects the ConfigMap by its labels. Exactly one ConfigMap
+	// must match the labels.
+	MatchLabels map[string]string `json:"matchLabels"`
+
+	// Key is the ConfigMap data key containing the function source.
+	// +kubebuilder:default:=index.js
+	Key string `json:"key,omitempty"`
+}
+
+// OCISource references an OCI artifact containing the function source.
+type OCISource struct {
+	// Reference is the artifact reference pinned by digest, e.g.
+	// `registry.example.org/scripts/bundle@sha256:...`.
+	Reference string `json:"reference"`
+
+	// Path is the path of the function source file in the artifact.
+	// +kubebuilder:default:=index.js
+	Path string `json:"path,omitempty"`
 }
@@ -0,0 +1,65 @@
+package js
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+
+	"github.com/salemove/crossplane-function-javascript/internal/lru"
+)
+
+// ProgramCache is a least recently used cache of compiled programs, keyed by
+// the hash of the script source. Compiled programs aren't linked to a runtime,
+// so the cache can be shared between multiple runtimes.
+type ProgramCache struct {
+	programs *lru.Cache[string, *compiled]
+}
+
+// NewProgramCache creates a new cache holding up to size compiled programs.
+func NewProgramCache(size int) *ProgramCache {
+	return &ProgramCache{programs: lru.New[string, *compiled](size)}
+}
+
+// Len returns the number of cached programs.
+func (c *ProgramCache) Len() int {
+	return c.programs.Len()
+}
+
+func (c *ProgramCache) get(key string) (*compiled, bool) {
+	return c.programs.Get(key)
+}
+
+func (c *ProgramCache) add(key string, program *compiled) {
+	c.programs.Add(key, program)
+}
+
+// cacheKey returns the key of the compiled script. The key includes the
+// script name, because it is embedded into the program for stack traces.
+func (s *Script) cacheKey() string {
+	h := sha256.New()
+	h.Write([]byte(s.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatBool(s.transpile)))
+	h.Write([]byte{0})
+	h.Write([]byte(s.transpiler))
+	h.Write([]byte{0})
+	h.Write([]byte(s.language))
+	h.Write([]byte{0})
+	h.Write([]byte(s.Source))
+
+	names := make([]string, 0, len(s.modules))
+	for name := range s.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(s.modules[name]))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,35 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgramCache(t *testing.T) {
+	cache := NewProgramCache(2)
+
+	run := func(source string, transpile bool, args ...interface{}) interface{} {
+		t.Helper()
+
+		script := NewRuntime().Script("test.js", source, args...)
+		res, err := script.Run(TranspileToES5(transpile), WithProgramCache(cache))
+		require.NoError(t, err)
+
+		return res
+	}
+
+	assert.EqualValues(t, 2, run(`export default n => n + 1`, true, 1))
+	assert.EqualValues(t, 3, run(`export default n => n + 1`, true, 2))
+	assert.Equal(t, 1, cache.Len(), "the same script must be compiled once")
+
+	assert.EqualValues(t, 1, run(`exports.default = function() { return 1 }`, false))
+	assert.EqualValues(t, 1, run(`exports.default = function() { return 1 }`, true))
+	assert.Equal(t, 2, cache.Len(), "the least recently used script must be evicted")
+
+	script := NewRuntime().Script("test.js", `export default n => n + 1`)
+	script.transpile = true
+	_, ok := cache.get(script.cacheKey())
+	assert.False(t, ok)
+}
@@ -0,0 +1,27 @@
+package js
+
+import (
+	"io"
+	"log"
+	"sync/atomic"
+
+	"github.com/dop251/goja_nodejs/console"
+)
+
+// consolePrinter prints the output of the console object of the scripts. If it isn't
+// set, the default printer of the console module is used.
+var consolePrinter atomic.Pointer[console.StdPrinter]
+
+// SetConsoleOutput sets the writers, to which the console object of the scripts
+// created afterwards prints: console.log, console.info and console.debug print
+// to stdout, and console.warn and console.error print to stderr. Unless it is
+// set, the default output of the console module is used.
+func SetConsoleOutput(stdout, stderr io.Writer) {
+	stdoutLogger := log.New(stdout, "", log.LstdFlags)
+	stderrLogger := log.New(stderr, "", log.LstdFlags)
+
+	consolePrinter.Store(&console.StdPrinter{
+		StdoutPrint: func(s string) { stdoutLogger.Print(s) },
+		StderrPrint: func(s string) { stderrLogger.Print(s) },
+	})
+}
@@ -0,0 +1,25 @@
+package js
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetConsoleOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	SetConsoleOutput(&stdout, &stderr)
+	t.Cleanup(func() { consolePrinter.Store(nil) })
+
+	_, err := NewRuntime().Script("console.js", `export default () => {
+		console.log('log');
+		console.error('error');
+	}`).Run(TranspileToES5(true))
+	require.NoError(t, err)
+
+	assert.Contains(t, stdout.String(), "log")
+	assert.NotContains(t, stdout.String(), "error")
+	assert.Contains(t, stderr.String(), "error")
+}
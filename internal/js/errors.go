@@ -0,0 +1,192 @@
+package js
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/file"
+)
+
+const (
+	// maxStackFrames is the maximum number of stack frames included in the error message.
+	maxStackFrames = 10
+
+	// codeFrameLines is the number of source lines shown around the error position.
+	codeFrameLines = 2
+)
+
+// ScriptError is the exception thrown by the script. The stack trace positions are
+// mapped to the original source code through the source maps, if the script has them.
+type ScriptError struct {
+	// Message of the thrown exception, e.g. "Error: something went wrong".
+	Message string
+
+	// Stack of the exception, starting from the frame where it was thrown.
+	Stack []StackFrame
+
+	// CodeFrame is the excerpt of the source code around the position where
+	// the exception was thrown, if the source code is available.
+	CodeFrame string
+
+	causes []error
+}
+
+// StackFrame is the position of the function call in the source code.
+type StackFrame struct {
+	FuncName string
+	file.Position
+}
+
+func (f StackFrame) String() string {
+	if f.Filename == "" {
+		return f.FuncName
+	}
+	return fmt.Sprintf("%s (%s:%d:%d)", f.FuncName, f.Filename, f.Line, f.Column)
+}
+
+// Error returns the message of the exception, followed by the stack trace and the code frame.
+func (e *ScriptError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+
+	for i, frame := range e.Stack {
+		if i == maxStackFrames {
+			fmt.Fprintf(&b, "\n    ... %d more", len(e.Stack)-i)
+			break
+		}
+		b.WriteString("\n    at ")
+		b.WriteString(frame.String())
+	}
+
+	if e.CodeFrame != "" {
+		b.WriteString("\n\n")
+		b.WriteString(e.CodeFrame)
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the original Goja exception, and ErrMaxCallStackSizeExceeded
+// if the script exceeded the maximum call stack size.
+func (e *ScriptError) Unwrap() []error {
+	return e.causes
+}
+
+// wrapError converts the exception thrown by the script into the ScriptError. Other errors,
+// e.g. interrupted script errors, are returned as is.
+func (c *compiled) wrapError(err error) error {
+	var (
+		exception     *goja.Exception
+		stackOverflow *goja.StackOverflowError
+		scriptErr     *ScriptError
+	)
+
+	switch {
+	case errors.As(err, &scriptErr):
+		return err
+	case errors.As(err, &stackOverflow):
+		scriptErr = &ScriptError{
+			Message: ErrMaxCallStackSizeExceeded.Error(),
+			causes:  []error{ErrMaxCallStackSizeExceeded, err},
+		}
+		exception = &stackOverflow.Exception
+	case errors.As(err, &exception):
+		scriptErr = &ScriptError{causes: []error{err}}
+		if val := exception.Value(); val != nil {
+			scriptErr.Message = val.String()
+		}
+	default:
+		return err
+	}
+
+	for _, frame := range exception.Stack() {
+		// Skip the native functions, e.g. JSON.parse, which have no position in the script.
+		if frame.SrcName() == "<native>" {
+			continue
+		}
+		scriptErr.Stack = append(scriptErr.Stack, StackFrame{
+			FuncName: frame.FuncName(),
+			Position: c.position(frame.Position()),
+		})
+	}
+
+	if len(scriptErr.Stack) > 0 {
+		scriptErr.CodeFrame = c.codeFrame(scriptErr.Stack[0].Position)
+	}
+
+	return scriptErr
+}
+
+// position corrects the position reported by Goja: the columns mapped through the source
+// map are zero-based, and the first line of the script without the source map is shifted
+// by the wrapper prefix. The file name resolved by Goja as the source map URL is unescaped.
+func (c *compiled) position(p file.Position) file.Position {
+	if name, err := url.PathUnescape(p.Filename); err == nil {
+		p.Filename = name
+	}
+
+	switch {
+	case c.sourceMapped:
+		p.Column++
+	case p.Filename == c.name && p.Line == 1:
+		p.Column -= len(wrapperPrefix)
+	}
+
+	return p
+}
+
+// codeFrame returns the source code lines around the position, with the position marked.
+func (c *compiled) codeFrame(p file.Position) string {
+	source, ok := c.sources[p.Filename]
+	if !ok || p.Line < 1 {
+		return ""
+	}
+
+	lines := strings.Split(source, "\n")
+	if p.Line > len(lines) {
+		return ""
+	}
+
+	first := max(p.Line-codeFrameLines, 1)
+	last := min(p.Line+codeFrameLines, len(lines))
+	width := len(fmt.Sprint(last))
+
+	var b strings.Builder
+	for n := first; n <= last; n++ {
+		line := strings.TrimRight(lines[n-1], "\r")
+
+		marker := " "
+		if n == p.Line {
+			marker = ">"
+		}
+		b.WriteString(strings.TrimRight(fmt.Sprintf("%s %*d | %s", marker, width, n, line), " "))
+		b.WriteByte('\n')
+
+		if n == p.Line && p.Column > 0 {
+			fmt.Fprintf(&b, "  %*s | %s^\n", width, "", columnIndent(line, p.Column))
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// columnIndent returns the whitespace preceding the column in the line, keeping the tabs,
+// so the column marker is aligned with the line.
+func columnIndent(line string, column int) string {
+	var b strings.Builder
+	for i, r := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bundledScript is a script bundled from src/handler.ts, with the inline source map
+// generated by the bundler.
+const bundledScript = `exports.default = function handler() { throw new Error("bundled") };
+//# sourceMappingURL=data:application/json;base64,eyJ2ZXJzaW9uIjozLCJzb3VyY2VzIjpbIi4uL3NyYy9oYW5kbGVyLnRzIl0sInNvdXJjZXNDb250ZW50IjpbImV4cG9ydCBkZWZhdWx0IGZ1bmN0aW9uIGhhbmRsZXIoKTogdm9pZCB7XG4gIHRocm93IG5ldyBFcnJvcihcImJ1bmRsZWRcIik7XG59XG4iXSwibmFtZXMiOltdLCJtYXBwaW5ncyI6IkFBQUEsdUNBQ0UifQ==
+`
+
+func TestRuntime_RunScriptErrors(t *testing.T) {
+	cases := []struct {
+		desc      string
+		name      string
+		script    string
+		transpile bool
+		expected  string
+	}{
+		{
+			desc: "transpiled script",
+			name: "test.js",
+			script: `export default function handler() {
+  return helper(1);
+}
+
+const helper = (n) => {
+  throw new Error(` + "`error ${n}`" + `);
+};
+`,
+			transpile: true,
+			expected: `Error: error 1
+    at helper (test.js:6:9)
+    at handler (test.js:2:17)
+
+  4 |
+  5 | const helper = (n) => {
+> 6 |   throw new Error(` + "`error ${n}`" + `);
+    |         ^
+  7 | };
+  8 |`,
+		},
+		{
+			desc:      "first line of transpiled script",
+			name:      "test.js",
+			script:    `export default () => { throw new Error("error") }`,
+			transpile: true,
+			expected: `Error: error
+    at _default (test.js:1:30)
+
+> 1 | export default () => { throw new Error("error") }
+    |                              ^`,
+		},
+		{
+			desc:   "first line of script without source map",
+			name:   "test.js",
+			script: `exports.default = function () { null.foo }`,
+			expected: `TypeError: Cannot read property 'foo' of undefined
+    at <anonymous> (test.js:1:38)
+
+> 1 | exports.default = function () { null.foo }
+    |                                      ^`,
+		},
+		{
+			desc:   "bundled script with source map",
+			name:   "dist/bundle.js",
+			script: bundledScript,
+			expected: `Error: bundled
+    at handler (src/handler.ts:2:3)
+
+  1 | export default function handler(): void {
+> 2 |   throw new Error("bundled");
+    |   ^
+  3 | }
+  4 |`,
+		},
+		{
+			desc:      "transpiled bundled script with source map",
+			name:      "dist/bundle.js",
+			script:    bundledScript,
+			transpile: true,
+			expected: `Error: bundled
+    at handler (src/handler.ts:2:3)
+
+  1 | export default function handler(): void {
+> 2 |   throw new Error("bundled");
+    |   ^
+  3 | }
+  4 |`,
+		},
+		{
+			desc:      "thrown values",
+			name:      "test.js",
+			script:    `export default () => { throw "error" }`,
+			transpile: true,
+			expected: `error
+    at _default (test.js:1:24)
+
+> 1 | export default () => { throw "error" }
+    |                        ^`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := NewRuntime()
+			_, err := r.Script(tc.name, tc.script).Run(TranspileToES5(tc.transpile))
+
+			var scriptErr *ScriptError
+			require.ErrorAs(t, err, &scriptErr)
+			assert.Equal(t, tc.expected, err.Error())
+		})
+	}
+}
+
+func TestRuntime_RunScriptErrorsFromCache(t *testing.T) {
+	cache := NewProgramCache(1)
+	script := "export default () => {\n  throw new Error(\"error\");\n}"
+
+	for i := 0; i < 2; i++ {
+		_, err := NewRuntime().Script("test.js", script).Run(TranspileToES5(true), WithProgramCache(cache))
+		require.EqualError(t, err, `Error: error
+    at _default (test.js:2:9)
+
+  1 | export default () => {
+> 2 |   throw new Error("error");
+    |         ^
+  3 | }`)
+	}
+}
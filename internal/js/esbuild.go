@@ -0,0 +1,213 @@
+package js
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// Transpiler is the tool transforming the script source code before it is compiled.
+type Transpiler string
+
+const (
+	// TranspilerBabel transpiles the script to ES5.1 with Babel, running in a Goja runtime.
+	TranspilerBabel Transpiler = "Babel"
+
+	// TranspilerESBuild transpiles the script with esbuild, which is native Go, and bundles
+	// it with the modules imported by the script. TypeScript sources are supported as well.
+	TranspilerESBuild Transpiler = "ESBuild"
+)
+
+// Language of the script source.
+type Language string
+
+const (
+	// LanguageJavaScript is the language of JavaScript sources.
+	LanguageJavaScript Language = "javascript"
+
+	// LanguageTypeScript is the language of TypeScript sources. The types are stripped
+	// by the ESBuild transpiler before the script is run.
+	LanguageTypeScript Language = "typescript"
+)
+
+// esbuildNamespace is the esbuild namespace of the script modules, which aren't loaded from files.
+const esbuildNamespace = "module"
+
+// esbuildTarget is the syntax supported by Goja. Newer syntax features are lowered by esbuild.
+const esbuildTarget = api.ES2017
+
+// esbuildExports is the global name of the bundle exports, which are copied into the script
+// exports, because the wrapper of the script doesn't support CommonJS modules.
+const esbuildExports = "__exports"
+
+// WithTranspiler selects the transpiler used when the transpilation is enabled.
+// Babel is used by default.
+func WithTranspiler(transpiler Transpiler) ScriptOption {
+	return func(s *Script) error {
+		switch transpiler {
+		case "":
+			s.transpiler = TranspilerBabel
+		case TranspilerBabel, TranspilerESBuild:
+			s.transpiler = transpiler
+		default:
+			return fmt.Errorf("unsupported transpiler %q, expected one of: %s, %s", transpiler, TranspilerBabel, TranspilerESBuild)
+		}
+		return nil
+	}
+}
+
+// WithLanguage sets the language of the script source. TypeScript sources require
+// the ESBuild transpiler. By default, the language is detected by the script name:
+// the scripts with the `.ts` extension are TypeScript, the others are JavaScript.
+func WithLanguage(language Language) ScriptOption {
+	return func(s *Script) error {
+		switch language {
+		case "", LanguageJavaScript, LanguageTypeScript:
+			s.language = language
+		default:
+			return fmt.Errorf("unsupported language %q, expected one of: %s, %s", language, LanguageJavaScript, LanguageTypeScript)
+		}
+		return nil
+	}
+}
+
+// WithModules makes the modules available to the relative imports of the script, e.g.
+// `import { helper } from "./lib"`. The modules are keyed by their paths relative to the
+// script, and are bundled with the script by esbuild, so they require the ESBuild transpiler.
+func WithModules(modules map[string]string) ScriptOption {
+	return func(s *Script) error {
+		s.modules = make(map[string]string, len(modules))
+		for name, source := range modules {
+			p := path.Clean(name)
+			if path.IsAbs(p) || p == "." || p == ".." || strings.HasPrefix(p, "../") {
+				return fmt.Errorf("invalid module path %q: must be relative to the script", name)
+			}
+			s.modules[p] = source
+		}
+		return nil
+	}
+}
+
+// bundle transpiles the script and bundles it with the imported modules using esbuild.
+// The script and its modules are never resolved on the file system.
+func bundle(name string, source string, language Language, modules map[string]string) (string, error) {
+	loader := esbuildLoader(name)
+	switch language {
+	case LanguageJavaScript:
+		loader = api.LoaderJS
+	case LanguageTypeScript:
+		loader = api.LoaderTS
+	}
+
+	result := api.Build(api.BuildOptions{
+		Stdin: &api.StdinOptions{
+			Contents:   source,
+			Sourcefile: path.Base(name),
+			Loader:     loader,
+		},
+		Bundle:     true,
+		Write:      false,
+		Format:     api.FormatIIFE,
+		GlobalName: esbuildExports,
+		Footer:     map[string]string{"js": "exports.default = " + esbuildExports + ".default;"},
+		Platform:   api.PlatformNeutral,
+		Target:     esbuildTarget,
+		Sourcemap:  api.SourceMapInline, // include source maps in the output for better stack traces
+		Charset:    api.CharsetUTF8,
+		LogLevel:   api.LogLevelSilent,
+		Plugins: []api.Plugin{{
+			Name:  "modules",
+			Setup: modulesPlugin(modules),
+		}},
+	})
+
+	if len(result.Errors) > 0 {
+		msgs := make([]string, 0, len(result.Errors))
+		for _, msg := range result.Errors {
+			msgs = append(msgs, esbuildMessage(name, msg))
+		}
+		return "", errors.New(strings.Join(msgs, "\n"))
+	}
+
+	if len(result.OutputFiles) != 1 {
+		return "", fmt.Errorf("expected exactly one bundle, esbuild produced %d", len(result.OutputFiles))
+	}
+
+	code := string(result.OutputFiles[0].Contents)
+
+	// The sources of the modules are prefixed with the esbuild namespace in the source map.
+	sm, err := findInlineSourceMap(code)
+	if err != nil || sm == nil {
+		return code, err
+	}
+
+	sources, _ := sm.data["sources"].([]interface{})
+	for i, src := range sources {
+		if s, ok := src.(string); ok {
+			sources[i] = strings.TrimPrefix(s, esbuildNamespace+":")
+		}
+	}
+
+	return sm.replace(code)
+}
+
+// modulesPlugin resolves the imports of the script to the modules. The imports of
+// the modules, which don't exist, and non-relative imports, e.g. the imports of
+// npm packages, are errors.
+func modulesPlugin(modules map[string]string) func(api.PluginBuild) {
+	return func(build api.PluginBuild) {
+		build.OnResolve(api.OnResolveOptions{Filter: ".*"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+			if !strings.HasPrefix(args.Path, "./") && !strings.HasPrefix(args.Path, "../") {
+				return api.OnResolveResult{}, fmt.Errorf("cannot resolve %q: only the relative imports of the input modules are supported", args.Path)
+			}
+
+			dir := "."
+			if args.Namespace == esbuildNamespace {
+				dir = path.Dir(args.Importer)
+			}
+
+			p := path.Join(dir, args.Path)
+			for _, candidate := range []string{p, p + ".ts", p + ".js", p + "/index.ts", p + "/index.js"} {
+				if _, ok := modules[candidate]; ok {
+					return api.OnResolveResult{Path: candidate, Namespace: esbuildNamespace}, nil
+				}
+			}
+
+			return api.OnResolveResult{}, fmt.Errorf("cannot resolve %q: module not found", args.Path)
+		})
+
+		build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: esbuildNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+			source := modules[args.Path]
+			return api.OnLoadResult{Contents: &source, Loader: esbuildLoader(args.Path)}, nil
+		})
+	}
+}
+
+// esbuildLoader returns the esbuild loader of the module, based on its extension.
+func esbuildLoader(name string) api.Loader {
+	switch path.Ext(name) {
+	case ".ts", ".mts", ".cts":
+		return api.LoaderTS
+	case ".json":
+		return api.LoaderJSON
+	default:
+		return api.LoaderJS
+	}
+}
+
+func esbuildMessage(name string, msg api.Message) string {
+	loc := msg.Location
+	if loc == nil {
+		return msg.Text
+	}
+
+	file := loc.File
+	if file == path.Base(name) {
+		file = name
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", strings.TrimPrefix(file, esbuildNamespace+":"), loc.Line, loc.Column+1, msg.Text)
+}
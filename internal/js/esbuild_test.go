@@ -0,0 +1,147 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntime_RunScriptWithESBuild(t *testing.T) {
+	cases := []struct {
+		desc     string
+		name     string
+		script   string
+		language Language
+		modules  map[string]string
+		args     []interface{}
+		expected interface{}
+		err      string
+	}{
+		{
+			desc:     "modern syntax",
+			name:     "test.js",
+			script:   `export default (o) => { const { a, ...rest } = { ...o, b: 2 }; return a + (rest.b ?? 0) + (o?.c?.d ?? 3) }`,
+			args:     []interface{}{map[string]interface{}{"a": 1}},
+			expected: 6,
+		},
+		{
+			desc: "classes",
+			name: "test.js",
+			script: `class Counter {
+  #count = 0;
+  static step = 2;
+  inc() { this.#count += Counter.step; return this; }
+  get value() { return this.#count; }
+}
+export default () => new Counter().inc().inc().value`,
+			expected: 4,
+		},
+		{
+			desc:     "TypeScript",
+			name:     "test.ts",
+			script:   `interface Args { n: number }; export default ({ n }: Args): number => n + 1`,
+			args:     []interface{}{map[string]interface{}{"n": 1}},
+			expected: 2,
+		},
+		{
+			desc:     "TypeScript language",
+			name:     "<inline.js>",
+			script:   `export default (n: number): number => n + 1`,
+			language: LanguageTypeScript,
+			args:     []interface{}{1},
+			expected: 2,
+		},
+		{
+			desc:     "JavaScript language",
+			name:     "test.ts",
+			script:   `export default (n: number): number => n + 1`,
+			language: LanguageJavaScript,
+			err:      `test.ts:1:18: Expected ")" but found ":"`,
+		},
+		{
+			desc:   "modules",
+			name:   "test.js",
+			script: `import { add } from "./lib/math"; import config from "./config.json"; export default (n) => add(n, config.step)`,
+			modules: map[string]string{
+				"lib/math.ts":   `import { identity } from "../util"; export const add = (a: number, b: number) => identity(a) + b`,
+				"util/index.js": `export const identity = (n) => n`,
+				"config.json":   `{"step": 10}`,
+			},
+			args:     []interface{}{1},
+			expected: 11,
+		},
+		{
+			desc:   "module not found",
+			name:   "test.js",
+			script: `import { add } from "./math"; export default (n) => add(n, 1)`,
+			err:    `test.js:1:21: cannot resolve "./math": module not found`,
+		},
+		{
+			desc:   "npm packages",
+			name:   "test.js",
+			script: `import _ from "lodash"; export default () => _.identity(1)`,
+			err:    `test.js:1:15: cannot resolve "lodash": only the relative imports of the input modules are supported`,
+		},
+		{
+			desc:    "invalid module path",
+			name:    "test.js",
+			script:  `export default () => 1`,
+			modules: map[string]string{"../lib.js": `export const one = 1`},
+			err:     `invalid module path "../lib.js": must be relative to the script`,
+		},
+		{
+			desc:   "syntax errors",
+			name:   "test.js",
+			script: "export default () => {\n  return 1 +\n}",
+			err:    `test.js:3:1: Unexpected "}"`,
+		},
+		{
+			desc:    "stack traces of modules",
+			name:    "scripts/test.js",
+			script:  `import { fail } from "./lib"; export default () => fail("error")`,
+			modules: map[string]string{"lib.js": "export function fail(msg) {\n  throw new Error(msg);\n}"},
+			err: `Error: error
+    at fail (scripts/lib.js:2:9)
+    at test_default (scripts/test.js:1:57)
+
+  1 | export function fail(msg) {
+> 2 |   throw new Error(msg);
+    |         ^
+  3 | }`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := NewRuntime()
+			script := r.Script(tc.name, tc.script, tc.args...)
+			res, err := script.Run(TranspileToES5(true), WithTranspiler(TranspilerESBuild), WithLanguage(tc.language), WithModules(tc.modules))
+
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.expected, res)
+		})
+	}
+}
+
+func TestRuntime_RunScriptRequiresESBuild(t *testing.T) {
+	modules := map[string]string{"lib.js": `export const one = 1`}
+
+	_, err := NewRuntime().Script("test.js", `export default () => 1`).Run(TranspileToES5(true), WithModules(modules))
+	require.EqualError(t, err, "modules are only supported by the ESBuild transpiler")
+
+	_, err = NewRuntime().Script("test.js", `export default (): number => 1`).Run(TranspileToES5(true), WithLanguage(LanguageTypeScript))
+	require.EqualError(t, err, "TypeScript sources are only supported by the ESBuild transpiler")
+
+	_, err = NewRuntime().Script("test.js", `export default (): number => 1`).Run(TranspileToES5(false), WithTranspiler(TranspilerESBuild), WithLanguage(LanguageTypeScript))
+	require.EqualError(t, err, "TypeScript sources are only supported by the ESBuild transpiler")
+
+	_, err = NewRuntime().Script("test.js", `export default () => 1`).Run(TranspileToES5(true), WithTranspiler("Webpack"))
+	require.EqualError(t, err, `unsupported transpiler "Webpack", expected one of: Babel, ESBuild`)
+}
@@ -0,0 +1,192 @@
+package js
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+)
+
+// intrinsics is the snapshot of the built-in objects reachable from the global object,
+// e.g. JSON, Array and Array.prototype. Scripts can modify them, e.g. override
+// Array.prototype.map, and such changes can't be reliably reverted, so the runtime
+// with the modified built-in objects is discarded instead of being reused.
+type intrinsics struct {
+	objects []*intrinsic
+
+	// globalProto is the prototype of the global object, which isn't restored by reset.
+	globalProto goja.Value
+
+	// Keep the references to the original functions, so the scripts can't tamper with them.
+	ownKeys                  goja.Callable
+	getOwnPropertyDescriptor goja.Callable
+	getPrototypeOf           goja.Callable
+	isExtensible             goja.Callable
+}
+
+// intrinsic is the state of a built-in object.
+type intrinsic struct {
+	obj        *goja.Object
+	proto      goja.Value
+	extensible bool
+	keys       []goja.Value
+	props      []property
+}
+
+// property is the own property descriptor of a built-in object.
+type property struct {
+	value, get, set                    goja.Value
+	writable, enumerable, configurable bool
+}
+
+func (p property) equal(other property) bool {
+	return sameValue(p.value, other.value) && sameValue(p.get, other.get) && sameValue(p.set, other.set) &&
+		p.writable == other.writable && p.enumerable == other.enumerable && p.configurable == other.configurable
+}
+
+// snapshotIntrinsics saves the state of the built-in objects reachable from the values
+// of the global object properties, and from their prototypes.
+func snapshotIntrinsics(vm *goja.Runtime, globals map[string]goja.Value) (*intrinsics, error) {
+	object := vm.Get("Object").ToObject(vm)
+	reflect := vm.Get("Reflect").ToObject(vm)
+
+	in := &intrinsics{}
+	in.ownKeys, _ = goja.AssertFunction(reflect.Get("ownKeys"))
+	in.getOwnPropertyDescriptor, _ = goja.AssertFunction(object.Get("getOwnPropertyDescriptor"))
+	in.getPrototypeOf, _ = goja.AssertFunction(object.Get("getPrototypeOf"))
+	in.isExtensible, _ = goja.AssertFunction(object.Get("isExtensible"))
+
+	global := vm.GlobalObject()
+
+	var err error
+	if in.globalProto, err = in.getPrototypeOf(goja.Undefined(), global); err != nil {
+		return nil, err
+	}
+
+	visited := map[*goja.Object]bool{global: true}
+	queue := []goja.Value{in.globalProto}
+	for _, val := range globals {
+		queue = append(queue, val)
+	}
+
+	for len(queue) > 0 {
+		obj, ok := queue[0].(*goja.Object)
+		queue = queue[1:]
+		if !ok || visited[obj] {
+			continue
+		}
+		visited[obj] = true
+
+		state, err := in.state(obj)
+		if err != nil {
+			return nil, err
+		}
+		in.objects = append(in.objects, state)
+
+		queue = append(queue, state.proto)
+		for _, prop := range state.props {
+			queue = append(queue, prop.value, prop.get, prop.set)
+		}
+	}
+
+	return in, nil
+}
+
+// check returns an error if any of the built-in objects was modified since the snapshot.
+func (in *intrinsics) check(vm *goja.Runtime) error {
+	proto, err := in.getPrototypeOf(goja.Undefined(), vm.GlobalObject())
+	if err != nil {
+		return err
+	}
+	if !sameValue(proto, in.globalProto) {
+		return fmt.Errorf("the prototype of the global object was modified")
+	}
+
+	for _, saved := range in.objects {
+		current, err := in.state(saved.obj)
+		if err != nil {
+			return err
+		}
+		if !saved.equal(current) {
+			return fmt.Errorf("built-in object %s was modified", saved.obj.ClassName())
+		}
+	}
+
+	return nil
+}
+
+func (in *intrinsics) state(obj *goja.Object) (*intrinsic, error) {
+	proto, err := in.getPrototypeOf(goja.Undefined(), obj)
+	if err != nil {
+		return nil, err
+	}
+
+	extensible, err := in.isExtensible(goja.Undefined(), obj)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := in.ownKeys(goja.Undefined(), obj)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &intrinsic{obj: obj, proto: proto, extensible: extensible.ToBoolean()}
+
+	keysObj, ok := keys.(*goja.Object)
+	if !ok {
+		return nil, fmt.Errorf("invalid own keys of built-in object %s", obj.ClassName())
+	}
+
+	n := int(keysObj.Get("length").ToInteger())
+	for i := 0; i < n; i++ {
+		key := keysObj.Get(fmt.Sprint(i))
+
+		val, err := in.getOwnPropertyDescriptor(goja.Undefined(), obj, key)
+		if err != nil {
+			return nil, err
+		}
+		desc, ok := val.(*goja.Object)
+		if !ok {
+			continue
+		}
+
+		state.keys = append(state.keys, key)
+		state.props = append(state.props, property{
+			value:        desc.Get("value"),
+			get:          desc.Get("get"),
+			set:          desc.Get("set"),
+			writable:     toBoolean(desc.Get("writable")),
+			enumerable:   toBoolean(desc.Get("enumerable")),
+			configurable: toBoolean(desc.Get("configurable")),
+		})
+	}
+
+	return state, nil
+}
+
+func (i *intrinsic) equal(other *intrinsic) bool {
+	if !sameValue(i.proto, other.proto) || i.extensible != other.extensible || len(i.keys) != len(other.keys) {
+		return false
+	}
+
+	for n := range i.keys {
+		if !sameValue(i.keys[n], other.keys[n]) || !i.props[n].equal(other.props[n]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// toBoolean converts the descriptor attribute to bool. The attributes, which
+// don't apply to the descriptor, e.g. writable of accessors, are missing.
+func toBoolean(val goja.Value) bool {
+	return val != nil && val.ToBoolean()
+}
+
+func sameValue(a, b goja.Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.SameAs(b)
+}
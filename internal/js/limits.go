@@ -0,0 +1,321 @@
+package js
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ErrMemoryLimitExceeded is the error wrapped by the script error when the
+// script is stopped because the memory limit was exceeded.
+var ErrMemoryLimitExceeded = errors.New("memory limit exceeded")
+
+// ErrMaxStringLengthExceeded is the error wrapped by the script error when the
+// script is stopped because it has created a string longer than the maximum length.
+var ErrMaxStringLengthExceeded = errors.New("maximum string length exceeded")
+
+// ErrMaxArrayLengthExceeded is the error wrapped by the script error when the
+// script is stopped because it has grown an array beyond the maximum length.
+var ErrMaxArrayLengthExceeded = errors.New("maximum array length exceeded")
+
+// ErrMaxCallStackSizeExceeded is the error wrapped by the script error when
+// the script is stopped because the maximum call stack size was exceeded.
+var ErrMaxCallStackSizeExceeded = errors.New("maximum call stack size exceeded")
+
+// memoryCheckInterval is the interval between memory limit checks.
+const memoryCheckInterval = 20 * time.Millisecond
+
+// memoryGCInterval is the minimum interval between the garbage collections
+// forced by the memory limit checks.
+const memoryGCInterval = time.Second
+
+const (
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+	heapLiveMetric    = "/gc/heap/live:bytes"
+	gcCyclesMetric    = "/gc/cycles/total:gc-cycles"
+)
+
+// WithMemoryLimit stops the script execution when the heap size of the process
+// exceeds the limit in bytes. Goja doesn't account the memory allocated by
+// scripts, so the heap size is checked periodically while the script is running.
+// The limit is process-wide: the heap is shared by all scripts running in the
+// process, so every running script with the exceeded limit is stopped, and the
+// process isn't killed by the OOM killer. It is the last resort, when the
+// script isn't stopped by WithMaxStringLength or WithMaxArrayLength first.
+func WithMemoryLimit(limit uint64) ScriptOption {
+	return func(s *Script) error {
+		s.memoryLimit = limit
+		return nil
+	}
+}
+
+// WithMaxStringLength stops the script, when it creates a string longer than
+// the length with the built-in string methods, e.g. String.prototype.repeat,
+// before the memory for the string is allocated. Only the script exceeding the
+// limit is stopped. The strings concatenated with operators, e.g. `s += s`,
+// aren't limited, so the memory limit is still required to protect the process.
+func WithMaxStringLength(length int) ScriptOption {
+	return func(s *Script) error {
+		s.maxStringLength = length
+		return nil
+	}
+}
+
+// WithMaxArrayLength stops the script, when it grows an array beyond the length
+// with the built-in array methods, e.g. Array.prototype.push. Only the script
+// exceeding the limit is stopped. The elements assigned by index aren't limited.
+func WithMaxArrayLength(length int) ScriptOption {
+	return func(s *Script) error {
+		s.maxArrayLength = length
+		return nil
+	}
+}
+
+// WithMaxCallStackSize limits the maximum function call depth of the script,
+// to prevent memory exhaustion caused by infinite recursion.
+func WithMaxCallStackSize(size int) ScriptOption {
+	return func(s *Script) error {
+		s.maxCallStackSize = size
+		return nil
+	}
+}
+
+// memory is the watcher of the heap size shared by all scripts running with the memory limit,
+// so the heap size is checked once per interval regardless of the number of the running scripts.
+var memory = &memoryWatcher{watches: make(map[*memoryWatch]struct{})}
+
+type memoryWatcher struct {
+	mu      sync.Mutex
+	watches map[*memoryWatch]struct{}
+	running bool
+
+	// The number of GC cycles and the time of the last cycle observed by the watcher,
+	// used to force the GC only if the heap wasn't collected recently. They are
+	// only accessed by the goroutine running the checks, and there is at most one.
+	gcCycles uint64
+	lastGC   time.Time
+}
+
+type memoryWatch struct {
+	limit     uint64
+	interrupt func()
+}
+
+// watchMemory calls the interrupt function once the heap size exceeds the limit.
+// The returned function stops watching. Once it returns, the interrupt function
+// isn't called anymore.
+func watchMemory(limit uint64, interrupt func()) (stop func()) {
+	return memory.watch(limit, interrupt)
+}
+
+func (w *memoryWatcher) watch(limit uint64, interrupt func()) (stop func()) {
+	watch := &memoryWatch{limit: limit, interrupt: interrupt}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.watches[watch] = struct{}{}
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+
+	return func() {
+		// The watches are interrupted with the lock held, so the interrupt, which has
+		// already started, is finished before the watch is removed.
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.watches, watch)
+	}
+}
+
+// run checks the heap size until there are no watches left.
+func (w *memoryWatcher) run() {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	// The time of the GC cycles before the watcher has started is unknown.
+	w.gcCycles = readMetric(gcCyclesMetric)
+	w.lastGC = time.Time{}
+
+	for range ticker.C {
+		if !w.check() {
+			return
+		}
+	}
+}
+
+// check interrupts the watches with the exceeded limits. It returns false, and marks
+// the watcher as stopped, if there are no watches left.
+func (w *memoryWatcher) check() bool {
+	limit, ok := w.minLimit()
+	if !ok {
+		return false
+	}
+
+	if readMetric(heapObjectsMetric) <= limit {
+		return true
+	}
+
+	// The heap includes the objects, which aren't collected yet, so the limits are checked
+	// against the live heap marked by the last GC. The GC is forced, unless the heap was
+	// collected recently, and it runs without the lock, so the scripts aren't blocked.
+	if cycles := readMetric(gcCyclesMetric); cycles != w.gcCycles {
+		w.gcCycles = cycles
+		w.lastGC = time.Now()
+	} else if time.Since(w.lastGC) >= memoryGCInterval {
+		runtime.GC()
+		w.gcCycles = readMetric(gcCyclesMetric)
+		w.lastGC = time.Now()
+	}
+
+	size := readMetric(heapLiveMetric)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for watch := range w.watches {
+		if size > watch.limit {
+			watch.interrupt()
+			delete(w.watches, watch)
+		}
+	}
+
+	return true
+}
+
+// minLimit returns the lowest limit of the watches. It returns false, and marks
+// the watcher as stopped, if there are no watches left.
+func (w *memoryWatcher) minLimit() (uint64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.watches) == 0 {
+		w.running = false
+		return 0, false
+	}
+
+	limit := uint64(math.MaxUint64)
+	for watch := range w.watches {
+		limit = min(limit, watch.limit)
+	}
+
+	return limit, true
+}
+
+// limitBuiltins wraps the built-in methods growing strings and arrays, so the script
+// exceeding the maximum string or array length is stopped before the memory is allocated.
+func (runtime *Runtime) limitBuiltins() {
+	vm := runtime.vm
+	stringProto := vm.Get("String").ToObject(vm).Get("prototype").ToObject(vm)
+	arrayProto := vm.Get("Array").ToObject(vm).Get("prototype").ToObject(vm)
+
+	runtime.limitMethod(stringProto, "repeat", func(call goja.FunctionCall) error {
+		return runtime.checkStringLength(runtime.length(call.This) * call.Argument(0).ToInteger())
+	})
+	padTo := func(call goja.FunctionCall) error {
+		return runtime.checkStringLength(call.Argument(0).ToInteger())
+	}
+	runtime.limitMethod(stringProto, "padStart", padTo)
+	runtime.limitMethod(stringProto, "padEnd", padTo)
+	runtime.limitMethod(stringProto, "concat", func(call goja.FunctionCall) error {
+		length := runtime.length(call.This)
+		for _, arg := range call.Arguments {
+			if _, ok := arg.Export().(string); ok {
+				length += runtime.length(arg)
+			}
+		}
+		return runtime.checkStringLength(length)
+	})
+
+	grow := func(call goja.FunctionCall) error {
+		return runtime.checkArrayLength(runtime.length(call.This) + int64(len(call.Arguments)))
+	}
+	runtime.limitMethod(arrayProto, "push", grow)
+	runtime.limitMethod(arrayProto, "unshift", grow)
+	runtime.limitMethod(arrayProto, "splice", func(call goja.FunctionCall) error {
+		return runtime.checkArrayLength(runtime.length(call.This) + int64(max(len(call.Arguments)-2, 0)))
+	})
+	runtime.limitMethod(arrayProto, "concat", func(call goja.FunctionCall) error {
+		length := runtime.length(call.This)
+		for _, arg := range call.Arguments {
+			if obj, ok := arg.(*goja.Object); ok && obj.ClassName() == "Array" {
+				length += runtime.length(obj)
+			} else {
+				length++
+			}
+		}
+		return runtime.checkArrayLength(length)
+	})
+}
+
+// limitMethod replaces the method of the object with the function, which stops the
+// script if the check fails, and calls the original method otherwise.
+func (runtime *Runtime) limitMethod(obj *goja.Object, name string, check func(call goja.FunctionCall) error) {
+	vm := runtime.vm
+	method := obj.Get(name).ToObject(vm)
+	original, _ := goja.AssertFunction(method)
+
+	fn := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if err := check(call); err != nil {
+			// The interrupt can't be caught by the script.
+			vm.Interrupt(err)
+			return goja.Undefined()
+		}
+
+		res, err := original(call.This, call.Arguments...)
+		if err != nil {
+			var interrupted *goja.InterruptedError
+			if errors.As(err, &interrupted) {
+				vm.Interrupt(interrupted.Value())
+				return goja.Undefined()
+			}
+			panic(err)
+		}
+		return res
+	}).ToObject(vm)
+
+	_ = fn.DefineDataProperty("name", method.Get("name"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	_ = fn.DefineDataProperty("length", method.Get("length"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	_ = obj.DefineDataProperty(name, fn, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+func (runtime *Runtime) checkStringLength(length int64) error {
+	if runtime.maxStringLength > 0 && length > int64(runtime.maxStringLength) {
+		return ErrMaxStringLengthExceeded
+	}
+	return nil
+}
+
+func (runtime *Runtime) checkArrayLength(length int64) error {
+	if runtime.maxArrayLength > 0 && length > int64(runtime.maxArrayLength) {
+		return ErrMaxArrayLengthExceeded
+	}
+	return nil
+}
+
+// length returns the length property of the value, e.g. of a string or an array.
+func (runtime *Runtime) length(val goja.Value) int64 {
+	return val.ToObject(runtime.vm).Get("length").ToInteger()
+}
+
+func heapSize() uint64 {
+	return readMetric(heapObjectsMetric)
+}
+
+func readMetric(name string) uint64 {
+	sample := []metrics.Sample{{Name: name}}
+	metrics.Read(sample)
+
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,143 @@
+package js
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntime_RunScriptWithMemoryLimit(t *testing.T) {
+	limit := heapSize() + 64<<20
+
+	r := NewRuntime()
+	script := r.Script("test.js", `export default () => {
+		const data = [];
+		while (true) { data.push('x'.repeat(1024) + data.length) }
+	}`)
+	_, err := script.Run(TranspileToES5(true), WithMemoryLimit(limit))
+
+	require.ErrorIs(t, err, ErrMemoryLimitExceeded)
+}
+
+func TestRuntime_RunScriptWithMaxStringAndArrayLength(t *testing.T) {
+	cases := []struct {
+		desc   string
+		script string
+		err    error
+	}{
+		{
+			desc:   "String.prototype.repeat",
+			script: `export default () => 'xx'.repeat(100)`,
+			err:    ErrMaxStringLengthExceeded,
+		},
+		{
+			desc:   "String.prototype.padStart",
+			script: `export default () => 'x'.padStart(101)`,
+			err:    ErrMaxStringLengthExceeded,
+		},
+		{
+			desc:   "String.prototype.padEnd",
+			script: `export default () => 'x'.padEnd(101)`,
+			err:    ErrMaxStringLengthExceeded,
+		},
+		{
+			desc:   "String.prototype.concat",
+			script: `export default () => 'x'.repeat(60).concat('x'.repeat(60))`,
+			err:    ErrMaxStringLengthExceeded,
+		},
+		{
+			desc:   "Array.prototype.push",
+			script: `export default () => { const a = []; while (true) { a.push(a.length) } }`,
+			err:    ErrMaxArrayLengthExceeded,
+		},
+		{
+			desc:   "Array.prototype.unshift",
+			script: `export default () => { const a = []; while (true) { a.unshift(a.length) } }`,
+			err:    ErrMaxArrayLengthExceeded,
+		},
+		{
+			desc:   "Array.prototype.splice",
+			script: `export default () => { const a = []; while (true) { a.splice(0, 0, 1, 2) } }`,
+			err:    ErrMaxArrayLengthExceeded,
+		},
+		{
+			desc:   "Array.prototype.concat",
+			script: `export default () => { let a = [1]; while (true) { a = a.concat(a) } }`,
+			err:    ErrMaxArrayLengthExceeded,
+		},
+		{
+			desc:   "caught by the script",
+			script: `export default () => { try { 'x'.repeat(1000) } catch (e) {} return 'caught' }`,
+			err:    ErrMaxStringLengthExceeded,
+		},
+		{
+			desc:   "within the limits",
+			script: `export default () => { const a = [1, 2].concat([3]); a.push('x'.repeat(10).padEnd(20).concat('y')); a.splice(0, 1); return a.length }`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := NewRuntime()
+			_, err := r.Script("test.js", tc.script).Run(TranspileToES5(true), WithMaxStringLength(100), WithMaxArrayLength(100))
+
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRuntime_RunScriptWithoutMaxStringAndArrayLength(t *testing.T) {
+	r := NewRuntime()
+	res, err := r.Script("test.js", `export default () => {
+		const a = [];
+		a.push(String.prototype.repeat.name, String.prototype.repeat.length, Array.prototype.push.name);
+		a.push('x'.repeat(1000).length);
+		return a.join(' ');
+	}`).Run(TranspileToES5(true))
+
+	require.NoError(t, err)
+	assert.Equal(t, "repeat 1 push 1000", res)
+}
+
+func TestWatchMemory(t *testing.T) {
+	var exceeded, unlimited, stopped atomic.Int32
+
+	stopExceeded := watchMemory(1, func() { exceeded.Add(1) })
+	stopUnlimited := watchMemory(math.MaxUint64, func() { unlimited.Add(1) })
+
+	// The stopped watch is never interrupted, even though its limit is exceeded.
+	watchMemory(1, func() { stopped.Add(1) })()
+
+	require.Eventually(t, func() bool { return exceeded.Load() > 0 }, time.Second, memoryCheckInterval)
+
+	stopExceeded()
+	stopUnlimited()
+
+	time.Sleep(3 * memoryCheckInterval)
+
+	assert.EqualValues(t, 1, exceeded.Load(), "the watch must be interrupted once")
+	assert.Zero(t, unlimited.Load())
+	assert.Zero(t, stopped.Load())
+
+	require.Eventually(t, func() bool {
+		memory.mu.Lock()
+		defer memory.mu.Unlock()
+		return !memory.running
+	}, time.Second, memoryCheckInterval, "the watcher must stop without watches")
+}
+
+func TestRuntime_RunScriptWithMaxCallStackSize(t *testing.T) {
+	r := NewRuntime()
+	script := r.Script("test.js", `export default function f() { return f() }`)
+	_, err := script.Run(TranspileToES5(true), WithMaxCallStackSize(100))
+
+	require.ErrorIs(t, err, ErrMaxCallStackSizeExceeded)
+}
@@ -0,0 +1,42 @@
+package js
+
+// Pool is a pool of reusable JavaScript runtimes. Creating a new runtime is
+// relatively expensive, so the runtimes are initialised once, and reset to
+// the clean global state before they are handed out again.
+type Pool struct {
+	runtimes chan *Runtime
+}
+
+// NewPool creates a new pool holding up to size idle runtimes. The pool is
+// filled with the initialised runtimes right away.
+func NewPool(size int) *Pool {
+	p := &Pool{runtimes: make(chan *Runtime, size)}
+	for i := 0; i < size; i++ {
+		p.runtimes <- NewRuntime()
+	}
+
+	return p
+}
+
+// Get returns an idle runtime from the pool, or creates a new one if the pool is empty.
+func (p *Pool) Get() *Runtime {
+	select {
+	case runtime := <-p.runtimes:
+		return runtime
+	default:
+		return NewRuntime()
+	}
+}
+
+// Put resets the runtime and returns it to the pool. The runtime is discarded
+// if it can't be reset, or if the pool is full.
+func (p *Pool) Put(runtime *Runtime) {
+	if err := runtime.reset(); err != nil {
+		return
+	}
+
+	select {
+	case p.runtimes <- runtime:
+	default:
+	}
+}
@@ -0,0 +1,104 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_IsolatesGlobals(t *testing.T) {
+	pool := NewPool(1)
+
+	run := func(source string) interface{} {
+		t.Helper()
+
+		runtime := pool.Get()
+		defer pool.Put(runtime)
+
+		res, err := runtime.Script("test.js", source).Run(TranspileToES5(true))
+		require.NoError(t, err)
+
+		return res
+	}
+
+	first := pool.Get()
+	pool.Put(first)
+
+	// top-level declarations don't conflict between the scripts
+	assert.EqualValues(t, 1, run(`const value = 1; export default () => value`))
+	assert.EqualValues(t, 2, run(`const value = 2; export default () => value`))
+
+	// globals defined or overwritten by the script are reset
+	assert.EqualValues(t, "function", run(`export default () => { globalThis.leaked = 1; btoa = 1; return typeof console.log }`))
+	assert.EqualValues(t, "undefined", run(`export default () => typeof leaked`))
+	assert.EqualValues(t, "function", run(`export default () => typeof btoa`))
+
+	// deleted globals are restored
+	assert.EqualValues(t, "undefined", run(`export default () => { delete globalThis.JSON; return typeof JSON }`))
+	assert.EqualValues(t, "object", run(`export default () => typeof JSON`))
+
+	second := pool.Get()
+	assert.Same(t, first, second, "the runtime must be reused")
+}
+
+func TestPool_DiscardsDirtyRuntimes(t *testing.T) {
+	pool := NewPool(1)
+
+	runtime := pool.Get()
+	_, err := runtime.Script("test.js", `
+		Object.defineProperty(globalThis, 'leaked', { value: 1, configurable: false });
+		exports.default = function() {};
+	`).Run()
+	require.NoError(t, err)
+	pool.Put(runtime)
+
+	assert.NotSame(t, runtime, pool.Get())
+}
+
+func TestPool_DiscardsRuntimesWithModifiedBuiltins(t *testing.T) {
+	cases := map[string]string{
+		"Object.prototype property":   `Object.prototype.leak = "x"`,
+		"built-in object property":    `JSON.foo = 1`,
+		"overridden prototype method": `Array.prototype.map = function() { return ["hijacked"] }`,
+		"deleted prototype method":    `delete String.prototype.trim`,
+		"built-in function property":  `Array.prototype.map.leak = 1`,
+		"changed prototype":           `Object.setPrototypeOf(Array.prototype, { leak: 1 })`,
+		"frozen built-in object":      `Object.freeze(Math)`,
+		"global object prototype":     `Object.setPrototypeOf(globalThis, { leak: 1 })`,
+	}
+
+	for name, mutation := range cases {
+		t.Run(name, func(t *testing.T) {
+			pool := NewPool(1)
+
+			runtime := pool.Get()
+			_, err := runtime.Script("test.js", mutation+`; exports.default = function() {};`).Run()
+			require.NoError(t, err)
+			pool.Put(runtime)
+
+			next := pool.Get()
+			assert.NotSame(t, runtime, next, "the runtime with modified built-in objects must be discarded")
+
+			res, err := next.Script("test.js", `exports.default = function() {
+				return [typeof ({}).leak, typeof JSON.foo, [1].map(function(n) { return n + 1 })[0], Object.isFrozen(Math)].join(" ")
+			}`).Run()
+			require.NoError(t, err)
+			assert.Equal(t, "undefined undefined 2 false", res)
+		})
+	}
+}
+
+func TestPool_ReusesRuntimesWithUnmodifiedBuiltins(t *testing.T) {
+	pool := NewPool(1)
+
+	runtime := pool.Get()
+	_, err := runtime.Script("test.js", `export default () => {
+		const items = [3, 1, 2].map((n) => n * 2).sort();
+		return JSON.stringify({ items, keys: Object.keys({ a: 1 }), date: new Date(0).toISOString() });
+	}`).Run(TranspileToES5(true))
+	require.NoError(t, err)
+	pool.Put(runtime)
+
+	assert.Same(t, runtime, pool.Get())
+}
@@ -1,12 +1,15 @@
 // Package js is a thin wrapper around Goja runtime.
 //
 // Because Goja itself doesn't support most of modern JS features,
-// the source code is transpiled by Babel before executing it,
+// the source code is transpiled by Babel or esbuild before executing it,
 // so we can actually write state migrations in ES5.1+.
 package js
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/console"
@@ -17,6 +20,19 @@ import (
 
 type Runtime struct {
 	vm *goja.Runtime
+
+	// globals is the snapshot of the global object properties taken after
+	// the runtime initialisation, used to reset the runtime between scripts.
+	globals          map[string]goja.Value
+	ownPropertyNames goja.Callable
+
+	// intrinsics is the snapshot of the built-in objects, used to detect the scripts
+	// modifying them, e.g. Array.prototype, so the runtime isn't reused.
+	intrinsics *intrinsics
+
+	// The limits of the running script, checked by the built-in methods.
+	maxStringLength int
+	maxArrayLength  int
 }
 
 type Script struct {
@@ -24,7 +40,18 @@ type Script struct {
 	Source string
 	Args   []interface{}
 
-	runtime *Runtime
+	runtime    *Runtime
+	transpile  bool
+	transpiler Transpiler
+	language   Language
+	modules    map[string]string
+	cache      *ProgramCache
+	ctx        context.Context
+
+	memoryLimit      uint64
+	maxStringLength  int
+	maxArrayLength   int
+	maxCallStackSize int
 }
 
 type ScriptOption func(s *Script) error
@@ -36,12 +63,88 @@ func NewRuntime() *Runtime {
 	vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
 
 	registry := new(require.Registry)
+	if printer := consolePrinter.Load(); printer != nil {
+		registry.RegisterNativeModule(console.ModuleName, console.RequireWithPrinter(printer))
+	}
 	registry.Enable(vm)
 
 	modules.Base64.Enable(vm)
 	console.Enable(vm)
 
-	return &Runtime{vm: vm}
+	runtime := &Runtime{vm: vm}
+	runtime.limitBuiltins()
+	runtime.snapshot()
+
+	return runtime
+}
+
+// snapshot saves the current state of the global object, so it can be restored by reset.
+func (runtime *Runtime) snapshot() {
+	// Keep the reference to the original function, so the scripts can't tamper with it.
+	runtime.ownPropertyNames, _ = goja.AssertFunction(runtime.vm.Get("Object").ToObject(runtime.vm).Get("getOwnPropertyNames"))
+
+	global := runtime.vm.GlobalObject()
+	names, _ := runtime.globalNames()
+
+	runtime.globals = make(map[string]goja.Value, len(names))
+	for _, name := range names {
+		runtime.globals[name] = global.Get(name)
+	}
+
+	runtime.intrinsics, _ = snapshotIntrinsics(runtime.vm, runtime.globals)
+}
+
+// reset restores the global object to the state saved by snapshot: the globals defined by
+// the previous scripts are deleted, and the overwritten or deleted globals are restored.
+// An error is returned if the global object can't be restored, e.g. if a script has
+// defined a non-configurable global, or if a script has modified the built-in objects.
+func (runtime *Runtime) reset() error {
+	runtime.vm.ClearInterrupt()
+
+	if runtime.intrinsics == nil {
+		return errors.New("the built-in objects weren't saved")
+	}
+	if err := runtime.intrinsics.check(runtime.vm); err != nil {
+		return err
+	}
+
+	global := runtime.vm.GlobalObject()
+	names, err := runtime.globalNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, ok := runtime.globals[name]; !ok {
+			if err := global.Delete(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, val := range runtime.globals {
+		if cur := global.Get(name); cur == nil || !cur.SameAs(val) {
+			if err := global.Set(name, val); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (runtime *Runtime) globalNames() ([]string, error) {
+	res, err := runtime.ownPropertyNames(goja.Undefined(), runtime.vm.GlobalObject())
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := runtime.vm.ExportTo(res, &names); err != nil {
+		return nil, err
+	}
+
+	return names, nil
 }
 
 // Set the specified variable in the global context.
@@ -60,7 +163,8 @@ func (runtime *Runtime) Script(name string, source string, args ...interface{})
 		Source: source,
 		Args:   args,
 
-		runtime: runtime,
+		runtime:    runtime,
+		transpiler: TranspilerBabel,
 	}
 }
 
@@ -72,11 +176,48 @@ func (s *Script) Run(opts ...ScriptOption) (interface{}, error) {
 			return nil, err
 		}
 	}
-	exports, err := s.runtime.compile(s.Name, s.Source)
+	c, err := s.compile()
 	if err != nil {
 		return nil, err
 	}
 
+	if s.maxCallStackSize > 0 {
+		s.runtime.vm.SetMaxCallStackSize(s.maxCallStackSize)
+	} else {
+		s.runtime.vm.SetMaxCallStackSize(math.MaxInt32)
+	}
+
+	s.runtime.maxStringLength = s.maxStringLength
+	s.runtime.maxArrayLength = s.maxArrayLength
+
+	if s.memoryLimit > 0 {
+		stop := watchMemory(s.memoryLimit, func() {
+			s.runtime.vm.Interrupt(ErrMemoryLimitExceeded)
+		})
+		defer stop()
+	}
+
+	if s.ctx != nil {
+		// The interrupted script returns *goja.InterruptedError wrapping the context error.
+		interrupted := make(chan struct{})
+		stop := context.AfterFunc(s.ctx, func() {
+			defer close(interrupted)
+			s.runtime.vm.Interrupt(s.ctx.Err())
+		})
+		defer func() {
+			// The interrupt must not land after the script returns, and the runtime is reset
+			// for the next script, so wait for the interrupt if it has already started.
+			if !stop() {
+				<-interrupted
+			}
+		}()
+	}
+
+	exports, err := s.runtime.run(c.program)
+	if err != nil {
+		return nil, c.wrapError(err)
+	}
+
 	def := exports.Get("default")
 
 	if fn, ok := goja.AssertFunction(def); ok {
@@ -85,7 +226,7 @@ func (s *Script) Run(opts ...ScriptOption) (interface{}, error) {
 		if val, err := fn(exports, values...); err == nil {
 			return val.Export(), nil
 		} else {
-			return nil, err
+			return nil, c.wrapError(err)
 		}
 	} else if def == nil {
 		return nil, fmt.Errorf("%s must export default function", s.Name)
@@ -94,46 +235,158 @@ func (s *Script) Run(opts ...ScriptOption) (interface{}, error) {
 	}
 }
 
-// TranspileToES5 transforms the script source code to ES5.1 using Babel
+// TranspileToES5 transforms the script source code to ES5.1 using the transpiler
+// selected by WithTranspiler, Babel by default.
 func TranspileToES5(val bool) ScriptOption {
 	return func(s *Script) error {
-		if !val {
-			return nil
+		s.transpile = val
+		return nil
+	}
+}
+
+// WithProgramCache caches the compiled script in the specified cache, so the
+// scripts with the same source aren't transpiled and compiled again.
+func WithProgramCache(cache *ProgramCache) ScriptOption {
+	return func(s *Script) error {
+		s.cache = cache
+		return nil
+	}
+}
+
+// WithContext stops the script execution when the context is cancelled or its deadline is exceeded.
+// In this case, the error returned by the script wraps the context error.
+func WithContext(ctx context.Context) ScriptOption {
+	return func(s *Script) error {
+		s.ctx = ctx
+		return nil
+	}
+}
+
+// compiled is the compiled script, with the original sources used to show the code
+// frame of the script errors.
+type compiled struct {
+	name    string
+	program *goja.Program
+
+	// sources are the original sources of the script, keyed by their names in the stack traces.
+	sources map[string]string
+	// sourceMapped is true if the stack trace positions are mapped through the source map.
+	sourceMapped bool
+}
+
+// compile transpiles the script source code, if requested, and compiles it into a program,
+// which can be run in any runtime.
+func (s *Script) compile() (*compiled, error) {
+	var key string
+	if s.cache != nil {
+		key = s.cacheKey()
+		if c, ok := s.cache.get(key); ok {
+			return c, nil
 		}
+	}
 
-		code, err := babel.TransformString(s.Source, map[string]interface{}{
-			"plugins": []interface{}{
-				[]interface{}{"transform-modules-commonjs", map[string]interface{}{"loose": false}},
-			},
-			"ast":            false,
-			"sourceMaps":     "inline", // include source maps in the output for better stack traces
-			"babelrc":        false,
-			"inputSourceMap": true, // if the function source already includes a source map, use it instead
-			"compact":        false,
-			"retainLines":    true,
-			"highlightCode":  false,
-		})
+	if len(s.modules) > 0 && (!s.transpile || s.transpiler != TranspilerESBuild) {
+		return nil, fmt.Errorf("modules are only supported by the %s transpiler", TranspilerESBuild)
+	}
+
+	if s.language == LanguageTypeScript && (!s.transpile || s.transpiler != TranspilerESBuild) {
+		return nil, fmt.Errorf("TypeScript sources are only supported by the %s transpiler", TranspilerESBuild)
+	}
 
+	source := s.Source
+	if s.transpile {
+		var (
+			code string
+			err  error
+		)
+		switch s.transpiler {
+		case TranspilerESBuild:
+			code, err = bundle(s.Name, source, s.language, s.modules)
+		default:
+			code, err = transpileToES5(s.Name, source)
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
+		source = code
+	}
 
-		s.Source = code
-		return nil
+	c := &compiled{
+		name:    s.Name,
+		sources: map[string]string{s.Name: s.Source},
+	}
+
+	sm, err := findInlineSourceMap(source)
+	if err != nil {
+		return nil, err
+	}
+	if sm != nil {
+		// The wrapper prefix shifts the first line of the script.
+		if err := sm.shiftFirstLine(len(wrapperPrefix)); err != nil {
+			return nil, err
+		}
+		if source, err = sm.replace(source); err != nil {
+			return nil, err
+		}
+		c.sources = sm.sources(s.Name)
+		c.sourceMapped = true
+	}
+
+	c.program, err = goja.Compile(s.Name, wrapperPrefix+source+wrapperSuffix, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cache != nil {
+		s.cache.add(key, c)
 	}
+
+	return c, nil
 }
 
-// compile runs a script from file and returns the value of "export default function" expression from the script.
-// The exported function then should be run separately.
-func (runtime *Runtime) compile(name string, source string) (*goja.Object, error) {
-	// CommonJS exports work, but we need to manually define an object with this property
-	_ = runtime.vm.Set("exports", map[string]interface{}{})
+func transpileToES5(name string, source string) (string, error) {
+	return babel.TransformString(source, map[string]interface{}{
+		"plugins": []interface{}{
+			[]interface{}{"transform-modules-commonjs", map[string]interface{}{"loose": false}},
+		},
+		"ast":            false,
+		"sourceMaps":     "inline", // include source maps in the output for better stack traces
+		"babelrc":        false,
+		"inputSourceMap": true, // if the function source already includes a source map, use it instead
+		"sourceFileName": name, // name of the original source in the stack traces
+		"compact":        false,
+		"retainLines":    true,
+		"highlightCode":  false,
+	})
+}
 
-	if _, err := runtime.vm.RunScript(name, source); err != nil {
+// The script source is wrapped into a function, so the top-level declarations of
+// the script don't leak into the global context, and the same script can be run
+// multiple times in the same runtime. The prefix is kept on the first line of the
+// script to preserve the line numbers in stack traces.
+const (
+	wrapperPrefix = "(function (exports) {"
+	wrapperSuffix = "\n})"
+)
+
+// run runs a compiled script and returns the value of "export default function" expression from the script.
+// The exported function then should be run separately.
+func (runtime *Runtime) run(program *goja.Program) (*goja.Object, error) {
+	wrapper, err := runtime.vm.RunProgram(program)
+	if err != nil {
 		return nil, err
 	}
 
-	exports := runtime.vm.Get("exports").ToObject(runtime.vm)
+	fn, ok := goja.AssertFunction(wrapper)
+	if !ok {
+		return nil, fmt.Errorf("invalid script wrapper: %s", wrapper)
+	}
+
+	// CommonJS exports work, but we need to manually define an object with this property
+	exports := runtime.vm.NewObject()
+	if _, err := fn(exports, exports); err != nil {
+		return nil, err
+	}
 
 	return exports, nil
 }
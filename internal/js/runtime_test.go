@@ -1,7 +1,9 @@
 package js
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -174,3 +176,32 @@ func TestRuntime_RunScript(t *testing.T) {
 		})
 	}
 }
+
+func TestRuntime_RunScriptWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	r := NewRuntime()
+	script := r.Script("test.js", `export default () => { while (true) {} }`)
+	_, err := script.Run(TranspileToES5(true), WithContext(ctx))
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRuntime_RunScriptWithContextDoesNotInterruptNextScript(t *testing.T) {
+	r := NewRuntime()
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// The context is cancelled while the script is finishing.
+		script := r.Script("test.js", `exports.default = function (cancel) { cancel(); return 1 }`, cancel)
+		_, _ = script.Run(WithContext(ctx))
+
+		require.NoError(t, r.reset())
+
+		res, err := r.Script("test.js", `exports.default = function () { return 2 }`).Run()
+		require.NoError(t, err, "the next script must not be interrupted")
+		assert.EqualValues(t, 2, res)
+	}
+}
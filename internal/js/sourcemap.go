@@ -0,0 +1,178 @@
+package js
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja/file"
+)
+
+const (
+	sourceMapComment   = "//# sourceMappingURL="
+	sourceMapURLPrefix = "data:application/json"
+)
+
+// inlineSourceMap is the inline source map of the script, supported by Goja. The source
+// map can be generated by Babel, or embedded into the script by a bundler, like esbuild.
+type inlineSourceMap struct {
+	// offset of the source map comment in the script source.
+	offset int
+	data   map[string]interface{}
+}
+
+// findInlineSourceMap returns the inline source map at the end of the script source, if any.
+func findInlineSourceMap(source string) (*inlineSourceMap, error) {
+	offset := strings.LastIndex(source, sourceMapComment)
+	if offset < 0 {
+		return nil, nil
+	}
+
+	// Goja only reads the source map comment on the last non-empty line.
+	line := strings.TrimRight(source[offset:], " \t\r\n")
+	if (offset > 0 && source[offset-1] != '\n') || strings.ContainsAny(line, "\r\n") {
+		return nil, nil
+	}
+
+	dataURL := line[len(sourceMapComment):]
+	if !strings.HasPrefix(dataURL, sourceMapURLPrefix) {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(dataURL[strings.Index(dataURL, ",")+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid inline source map: %w", err)
+	}
+
+	sm := &inlineSourceMap{offset: offset}
+	if err := json.Unmarshal(raw, &sm.data); err != nil {
+		return nil, fmt.Errorf("invalid inline source map: %w", err)
+	}
+
+	return sm, nil
+}
+
+// shiftFirstLine shifts the generated columns of the first line by the specified number
+// of characters. The wrapper prefix is prepended to the first line of the script, so the
+// generated columns of the first line have to be shifted to map to the original source.
+func (sm *inlineSourceMap) shiftFirstLine(shift int) error {
+	mappings, ok := sm.data["mappings"].(string)
+	if !ok {
+		return nil
+	}
+
+	// Only the first segment of each line has the absolute generated column,
+	// the columns of the other segments are relative to the previous segment.
+	end := strings.IndexAny(mappings, ",;")
+	if end < 0 {
+		end = len(mappings)
+	}
+	if end == 0 {
+		return nil
+	}
+
+	col, n, err := decodeVLQ(mappings[:end])
+	if err != nil {
+		return fmt.Errorf("invalid inline source map: %w", err)
+	}
+
+	sm.data["mappings"] = encodeVLQ(col+shift) + mappings[n:]
+
+	return nil
+}
+
+// sources returns the content of the original sources included into the source map,
+// keyed by their names resolved the same way Goja does for stack traces.
+func (sm *inlineSourceMap) sources(name string) map[string]string {
+	names, _ := sm.data["sources"].([]interface{})
+	contents, _ := sm.data["sourcesContent"].([]interface{})
+
+	sources := make(map[string]string, len(names))
+	for i, n := range names {
+		src, ok := n.(string)
+		if !ok || i >= len(contents) {
+			continue
+		}
+
+		content, ok := contents[i].(string)
+		if !ok {
+			continue
+		}
+
+		if u := file.ResolveSourcemapURL(name, src); u != nil {
+			src = u.String()
+		}
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		sources[src] = content
+	}
+
+	return sources
+}
+
+// replace returns the script source with the inline source map replaced by this one.
+func (sm *inlineSourceMap) replace(source string) (string, error) {
+	raw, err := json.Marshal(sm.data)
+	if err != nil {
+		return "", err
+	}
+
+	return source[:sm.offset] + sourceMapComment + sourceMapURLPrefix + ";base64," + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+const vlqBase64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+const (
+	vlqBaseShift       = 5
+	vlqBaseMask        = 1<<vlqBaseShift - 1
+	vlqContinuationBit = 1 << vlqBaseShift
+)
+
+// decodeVLQ decodes the first Base64 VLQ value of the source map segment, and returns the
+// value and the number of the decoded characters.
+func decodeVLQ(s string) (int, int, error) {
+	var value, shift int
+
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(vlqBase64, s[i])
+		if digit < 0 {
+			return 0, 0, fmt.Errorf("invalid VLQ character %q", s[i])
+		}
+
+		value += (digit & vlqBaseMask) << shift
+		if digit&vlqContinuationBit == 0 {
+			if value&1 != 0 {
+				return -(value >> 1), i + 1, nil
+			}
+			return value >> 1, i + 1, nil
+		}
+		shift += vlqBaseShift
+	}
+
+	return 0, 0, fmt.Errorf("unterminated VLQ value %q", s)
+}
+
+// encodeVLQ encodes the value as Base64 VLQ.
+func encodeVLQ(value int) string {
+	if value < 0 {
+		value = -value<<1 | 1
+	} else {
+		value <<= 1
+	}
+
+	var b strings.Builder
+	for {
+		digit := value & vlqBaseMask
+		value >>= vlqBaseShift
+		if value > 0 {
+			digit |= vlqContinuationBit
+		}
+		b.WriteByte(vlqBase64[digit])
+		if value == 0 {
+			return b.String()
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package lru implements a least recently used cache.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a least recently used cache holding up to size values. Once the
+// cache is full, adding a new value evicts the least recently used one.
+// The cache is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	size int
+
+	mu       sync.Mutex
+	entries  map[K]*list.Element
+	eviction *list.List
+}
+
+type entry[K comparable, V any] struct {
+	key K
+	val V
+}
+
+// New creates a new cache holding up to size values.
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:     size,
+		entries:  make(map[K]*list.Element, size),
+		eviction: list.New(),
+	}
+}
+
+// Len returns the number of cached values.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.eviction.Len()
+}
+
+// Get returns the value cached by the key, and marks it as the most recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	c.eviction.MoveToFront(el)
+
+	return el.Value.(*entry[K, V]).val, true
+}
+
+// Add caches the value by the key, evicting the least recently used values
+// if the cache is full.
+func (c *Cache[K, V]) Add(key K, val V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.eviction.MoveToFront(el)
+		el.Value.(*entry[K, V]).val = val
+		return
+	}
+
+	c.entries[key] = c.eviction.PushFront(&entry[K, V]{key: key, val: val})
+
+	for c.eviction.Len() > c.size {
+		el := c.eviction.Back()
+		c.eviction.Remove(el)
+		delete(c.entries, el.Value.(*entry[K, V]).key)
+	}
+}
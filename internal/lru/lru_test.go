@@ -0,0 +1,45 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New[string, int](2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// a becomes the most recently used, so b is evicted.
+	val, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	c.Add("c", 3)
+	assert.Equal(t, 2, c.Len())
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	val, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, val)
+
+	c.Add("a", 4)
+	val, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 4, val)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestCache_ZeroSize(t *testing.T) {
+	c := New[string, int](0)
+
+	c.Add("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Zero(t, c.Len())
+}
@@ -0,0 +1,74 @@
+// Package scripts loads function scripts from the filesystem.
+package scripts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Dir loads scripts from a directory, e.g. a volume mounted into the function
+// pod. The contents of the loaded scripts are cached, and reloaded when the
+// files change on disk.
+type Dir struct {
+	root string
+
+	mu    sync.Mutex
+	files map[string]*file
+}
+
+type file struct {
+	modTime time.Time
+	size    int64
+	content string
+}
+
+// NewDir creates a new script loader for the specified directory.
+func NewDir(root string) *Dir {
+	return &Dir{
+		root:  root,
+		files: make(map[string]*file),
+	}
+}
+
+// Load returns the content of the script with the specified path, relative
+// to the scripts directory. The path must not point outside the directory.
+func (d *Dir) Load(name string) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid script path %q: must be relative to the scripts directory", name)
+	}
+
+	path := filepath.Join(d.root, name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		return "", fmt.Errorf("invalid script path %q: is a directory", name)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if f, ok := d.files[name]; ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+		return f.content, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	d.files[name] = &file{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		content: string(content),
+	}
+
+	return string(content), nil
+}
@@ -0,0 +1,85 @@
+package scripts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDir_Load(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "lib", "main.js"), []byte("v1"), 0o600))
+
+	cases := []struct {
+		desc     string
+		name     string
+		ok       bool
+		expected string
+	}{
+		{
+			desc:     "file in a subdirectory",
+			name:     "lib/main.js",
+			ok:       true,
+			expected: "v1",
+		},
+		{
+			desc: "missing file",
+			name: "lib/missing.js",
+			ok:   false,
+		},
+		{
+			desc: "directory",
+			name: "lib",
+			ok:   false,
+		},
+		{
+			desc: "path outside the directory",
+			name: "../main.js",
+			ok:   false,
+		},
+		{
+			desc: "absolute path",
+			name: "/etc/passwd",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := NewDir(root)
+			content, err := d.Load(tc.name)
+
+			if tc.ok {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, content)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestDir_LoadReloadsChangedFiles(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "main.js")
+	require.NoError(t, os.WriteFile(path, []byte("v1"), 0o600))
+
+	d := NewDir(root)
+
+	content, err := d.Load("main.js")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", content)
+
+	require.NoError(t, os.WriteFile(path, []byte("v2"), 0o600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	content, err = d.Load("main.js")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", content)
+}
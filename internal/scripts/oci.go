@@ -0,0 +1,130 @@
+package scripts
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/salemove/crossplane-function-javascript/internal/lru"
+)
+
+// AnnotationTitle is the OCI annotation containing the file name of an
+// artifact layer, as set by ORAS for pushed files.
+const AnnotationTitle = "org.opencontainers.image.title"
+
+// OCI loads scripts from OCI artifacts referenced by digest. Because the
+// artifacts are immutable, the loaded scripts are cached by digest, and
+// aren't pulled again while they stay in the cache.
+type OCI struct {
+	opts  []remote.Option
+	files *lru.Cache[string, string]
+}
+
+// NewOCI creates a new script loader pulling artifacts from OCI registries,
+// which caches up to size loaded files. By default, the registry credentials
+// are read from the default keychain (e.g. the Docker config file).
+func NewOCI(size int, opts ...remote.Option) *OCI {
+	return &OCI{
+		opts:  append([]remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}, opts...),
+		files: lru.New[string, string](size),
+	}
+}
+
+// Load returns the content of the file with the specified path from the OCI
+// artifact. The reference must be pinned by digest, e.g.
+// registry.example.org/scripts/bundle@sha256:....
+//
+// The file is looked up by the title annotation of the artifact layers first
+// (e.g. artifacts pushed with ORAS), and then in the filesystem of the image,
+// if the artifact is a regular container image.
+func (o *OCI) Load(ctx context.Context, ref string, file string) (string, error) {
+	digest, err := name.NewDigest(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact reference %q: must be pinned by digest: %w", ref, err)
+	}
+
+	file = path.Clean("/" + file)[1:]
+	key := digest.DigestStr() + "/" + file
+
+	if content, ok := o.files.Get(key); ok {
+		return content, nil
+	}
+
+	// The manifest and layer digests are verified by the registry client
+	// while pulling the artifact.
+	img, err := remote.Image(digest, append(o.opts, remote.WithContext(ctx))...)
+	if err != nil {
+		return "", fmt.Errorf("cannot pull artifact %q: %w", ref, err)
+	}
+
+	content, err := readFile(img, file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %q from artifact %q: %w", file, ref, err)
+	}
+
+	o.files.Add(key, content)
+
+	return content, nil
+}
+
+func readFile(img v1.Image, file string) (string, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	for _, desc := range manifest.Layers {
+		if desc.Annotations[AnnotationTitle] != file {
+			continue
+		}
+
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+
+		rc, err := layer.Compressed()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close() //nolint:errcheck // Nothing to do with the error here.
+
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			return "", err
+		}
+
+		return string(content), nil
+	}
+
+	rc := mutate.Extract(img)
+	defer rc.Close() //nolint:errcheck // Nothing to do with the error here.
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("file not found")
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if hdr.Typeflag == tar.TypeReg && path.Clean("/" + hdr.Name)[1:] == file {
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return "", err
+			}
+
+			return string(content), nil
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package scripts
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCI_Load(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	artifact := push(t, u.Host+"/scripts/artifact", artifactImage(t, map[string]string{
+		"index.js": "artifact",
+	}))
+	image := push(t, u.Host+"/scripts/image", imageWithFiles(t, map[string]string{
+		"lib/index.js": "image",
+	}))
+
+	cases := []struct {
+		desc     string
+		ref      string
+		file     string
+		ok       bool
+		expected string
+	}{
+		{
+			desc:     "artifact file",
+			ref:      artifact,
+			file:     "index.js",
+			ok:       true,
+			expected: "artifact",
+		},
+		{
+			desc:     "image file",
+			ref:      image,
+			file:     "lib/index.js",
+			ok:       true,
+			expected: "image",
+		},
+		{
+			desc:     "image file with absolute path",
+			ref:      image,
+			file:     "/lib/index.js",
+			ok:       true,
+			expected: "image",
+		},
+		{
+			desc: "missing file",
+			ref:  image,
+			file: "missing.js",
+			ok:   false,
+		},
+		{
+			desc: "reference without digest",
+			ref:  u.Host + "/scripts/image:latest",
+			file: "lib/index.js",
+			ok:   false,
+		},
+		{
+			desc: "unknown digest",
+			ref:  u.Host + "/scripts/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			file: "lib/index.js",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			o := NewOCI(16)
+			content, err := o.Load(context.Background(), tc.ref, tc.file)
+
+			if tc.ok {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, content)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestOCI_LoadCachesByDigest(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	ref := push(t, u.Host+"/scripts/artifact", artifactImage(t, map[string]string{
+		"index.js": "artifact",
+	}))
+
+	o := NewOCI(16)
+
+	content, err := o.Load(context.Background(), ref, "index.js")
+	require.NoError(t, err)
+	assert.Equal(t, "artifact", content)
+
+	srv.Close()
+
+	content, err = o.Load(context.Background(), ref, "index.js")
+	require.NoError(t, err)
+	assert.Equal(t, "artifact", content)
+}
+
+func TestOCI_LoadEvictsLeastRecentlyUsed(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	ref := push(t, u.Host+"/scripts/artifact", artifactImage(t, map[string]string{
+		"a.js": "a",
+		"b.js": "b",
+		"c.js": "c",
+	}))
+
+	o := NewOCI(2)
+
+	for _, file := range []string{"a.js", "b.js", "a.js", "c.js"} {
+		_, err := o.Load(context.Background(), ref, file)
+		require.NoError(t, err)
+	}
+
+	srv.Close()
+
+	// b.js is evicted, because a.js was used after it.
+	content, err := o.Load(context.Background(), ref, "a.js")
+	require.NoError(t, err)
+	assert.Equal(t, "a", content)
+
+	content, err = o.Load(context.Background(), ref, "c.js")
+	require.NoError(t, err)
+	assert.Equal(t, "c", content)
+
+	_, err = o.Load(context.Background(), ref, "b.js")
+	require.Error(t, err)
+}
+
+func push(t *testing.T, repo string, img v1.Image) string {
+	t.Helper()
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	ref, err := name.NewDigest(repo + "@" + digest.String())
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	return ref.String()
+}
+
+func artifactImage(t *testing.T, files map[string]string) v1.Image {
+	t.Helper()
+
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	for file, content := range files {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(content), "application/javascript"),
+			Annotations: map[string]string{AnnotationTitle: file},
+		})
+		require.NoError(t, err)
+	}
+
+	return img
+}
+
+func imageWithFiles(t *testing.T, files map[string]string) v1.Image {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for file, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     file,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	return img
+}
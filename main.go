@@ -2,15 +2,45 @@
 package main
 
 import (
+	"time"
+
 	"github.com/alecthomas/kong"
+	"github.com/salemove/crossplane-function-javascript/internal/js"
+	"github.com/salemove/crossplane-function-javascript/internal/scripts"
+	"k8s.io/apimachinery/pkg/api/resource"
 
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/function-sdk-go"
 )
 
 // CLI of this Function.
 type CLI struct {
+	Serve  ServeCmd  `cmd:"" default:"withargs" help:"Serve the function over gRPC (default)."`
+	Render RenderCmd `cmd:"" help:"Run the function locally against a request, or a composite resource and a Composition, and print the response."`
+	Test   TestCmd   `cmd:"" help:"Run the scripts against the *.test.yaml fixtures, and report the differences from the expected responses."`
+}
+
+// FunctionFlags configure the function runtime, and are shared by all commands.
+type FunctionFlags struct {
 	Debug bool `short:"d" help:"Emit debug logs in addition to info logs."`
 
+	ScriptsDir string `help:"Directory containing function scripts, which can be referenced by File sources." type:"existingdir" env:"SCRIPTS_DIR"`
+
+	ProgramCacheSize int           `help:"Maximum number of compiled scripts to keep in the cache. Set to 0 to disable the cache." default:"128" env:"PROGRAM_CACHE_SIZE"`
+	OCICacheSize     int           `help:"Maximum number of files loaded from OCI artifacts to keep in the cache. Set to 0 to disable the cache." default:"128" env:"OCI_CACHE_SIZE"`
+	RuntimePoolSize  int           `help:"Maximum number of idle JavaScript runtimes kept for reuse. Set to 0 to create a new runtime for each call." default:"16" env:"RUNTIME_POOL_SIZE"`
+	Timeout          time.Duration `help:"Default maximum duration of the script execution, unless specified in the function input. Set to 0 to disable the timeout." default:"20s" env:"SCRIPT_TIMEOUT"`
+	MaxStringLength  int           `help:"Maximum length of the strings created by the scripts with the built-in string methods. The script exceeding it is stopped. Set to 0 to disable the limit." default:"16777216" env:"SCRIPT_MAX_STRING_LENGTH"`
+	MaxArrayLength   int           `help:"Maximum length of the arrays grown by the scripts with the built-in array methods. The script exceeding it is stopped. Set to 0 to disable the limit." default:"1048576" env:"SCRIPT_MAX_ARRAY_LENGTH"`
+	MemoryLimit      string        `help:"Process-wide heap size of the function (e.g. 512Mi), above which all running scripts are stopped, not only the one allocating the memory. Unlimited if not set." env:"SCRIPT_MEMORY_LIMIT"`
+	MaxCallStackSize int           `help:"Maximum function call depth of the scripts. Set to 0 to disable the limit." default:"10000" env:"SCRIPT_MAX_CALL_STACK_SIZE"`
+}
+
+// ServeCmd serves the function over gRPC.
+type ServeCmd struct {
+	FunctionFlags `embed:""`
+
 	Network     string `help:"Network on which to listen for gRPC connections." default:"tcp"`
 	Address     string `help:"Address at which to listen for gRPC connections." default:":9443"`
 	TLSCertsDir string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
@@ -18,18 +48,53 @@ type CLI struct {
 }
 
 // Run this Function.
-func (c *CLI) Run() error {
+func (c *ServeCmd) Run() error {
 	log, err := function.NewLogger(c.Debug)
 	if err != nil {
 		return err
 	}
 
-	return function.Serve(&Function{log: log},
+	fn, err := c.newFunction(log)
+	if err != nil {
+		return err
+	}
+
+	return function.Serve(fn,
 		function.Listen(c.Network, c.Address),
 		function.MTLSCertificates(c.TLSCertsDir),
 		function.Insecure(c.Insecure))
 }
 
+// newFunction creates the Function configured by the flags.
+func (c *FunctionFlags) newFunction(log logging.Logger) (*Function, error) {
+	fn := &Function{
+		log:              log,
+		oci:              scripts.NewOCI(c.OCICacheSize),
+		timeout:          c.Timeout,
+		maxStringLength:  c.MaxStringLength,
+		maxArrayLength:   c.MaxArrayLength,
+		maxCallStackSize: c.MaxCallStackSize,
+	}
+	if c.MemoryLimit != "" {
+		limit, err := resource.ParseQuantity(c.MemoryLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid memory limit")
+		}
+		fn.memoryLimit = uint64(limit.Value())
+	}
+	if c.ProgramCacheSize > 0 {
+		fn.programs = js.NewProgramCache(c.ProgramCacheSize)
+	}
+	if c.RuntimePoolSize > 0 {
+		fn.runtimes = js.NewPool(c.RuntimePoolSize)
+	}
+	if c.ScriptsDir != "" {
+		fn.scripts = scripts.NewDir(c.ScriptsDir)
+	}
+
+	return fn, nil
+}
+
 func main() {
 	ctx := kong.Parse(&CLI{}, kong.Description("A Crossplane JavaScript Composition Function."))
 	ctx.FatalIfErrorf(ctx.Run())
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// Readiness check types, matching the readiness checks of the Patch and
+// Transform Compositions.
+const (
+	ReadinessCheckTypeNonEmpty       = "NonEmpty"
+	ReadinessCheckTypeMatchString    = "MatchString"
+	ReadinessCheckTypeMatchInteger   = "MatchInteger"
+	ReadinessCheckTypeMatchTrue      = "MatchTrue"
+	ReadinessCheckTypeMatchFalse     = "MatchFalse"
+	ReadinessCheckTypeMatchCondition = "MatchCondition"
+	ReadinessCheckTypeNone           = "None"
+)
+
+// ReadinessCheck checks the field of the observed composed resource to
+// determine whether the resource is ready.
+type ReadinessCheck struct {
+	Type           string               `json:"type"`
+	FieldPath      string               `json:"fieldPath,omitempty"`
+	MatchString    string               `json:"matchString,omitempty"`
+	MatchInteger   int64                `json:"matchInteger,omitempty"`
+	MatchCondition *MatchConditionCheck `json:"matchCondition,omitempty"`
+}
+
+// MatchConditionCheck matches the status of the observed resource condition.
+type MatchConditionCheck struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// Validate returns an error if the readiness check is invalid.
+func (c *ReadinessCheck) Validate() error {
+	switch c.Type {
+	case ReadinessCheckTypeNone:
+		return nil
+	case ReadinessCheckTypeNonEmpty, ReadinessCheckTypeMatchString, ReadinessCheckTypeMatchInteger,
+		ReadinessCheckTypeMatchTrue, ReadinessCheckTypeMatchFalse:
+		if c.FieldPath == "" {
+			return errors.Errorf("fieldPath is required for %s check", c.Type)
+		}
+		return nil
+	case ReadinessCheckTypeMatchCondition:
+		if c.MatchCondition == nil || c.MatchCondition.Type == "" || c.MatchCondition.Status == "" {
+			return errors.Errorf("matchCondition type and status are required for %s check", c.Type)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown readiness check type %q", c.Type)
+	}
+}
+
+// IsReady returns true if the observed resource passes the readiness check.
+func (c *ReadinessCheck) IsReady(obj *composed.Unstructured) bool {
+	switch c.Type {
+	case ReadinessCheckTypeNone:
+		return true
+	case ReadinessCheckTypeNonEmpty:
+		_, err := obj.GetValue(c.FieldPath)
+		return err == nil
+	case ReadinessCheckTypeMatchString:
+		val, err := obj.GetString(c.FieldPath)
+		return err == nil && val == c.MatchString
+	case ReadinessCheckTypeMatchInteger:
+		val, err := obj.GetInteger(c.FieldPath)
+		return err == nil && val == c.MatchInteger
+	case ReadinessCheckTypeMatchTrue:
+		val, err := obj.GetBool(c.FieldPath)
+		return err == nil && val
+	case ReadinessCheckTypeMatchFalse:
+		val, err := obj.GetBool(c.FieldPath)
+		return err == nil && !val
+	case ReadinessCheckTypeMatchCondition:
+		cond := obj.GetCondition(xpv1.ConditionType(c.MatchCondition.Type))
+		return string(cond.Status) == c.MatchCondition.Status
+	default:
+		return false
+	}
+}
+
+// checkReadiness returns whether the observed composed resource passes all the readiness checks.
+// The resource which isn't observed yet is not ready.
+func checkReadiness(observed resource.ObservedComposed, ok bool, checks []ReadinessCheck) resource.Ready {
+	if !ok || observed.Resource == nil {
+		return resource.ReadyFalse
+	}
+
+	for _, check := range checks {
+		if !check.IsReady(observed.Resource) {
+			return resource.ReadyFalse
+		}
+	}
+
+	return resource.ReadyTrue
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/salemove/crossplane-function-javascript/internal/js"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/function-sdk-go"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+const (
+	// AnnotationCompositionResourceName is the annotation of the composed
+	// resources containing their names in the Composition.
+	AnnotationCompositionResourceName = "crossplane.io/composition-resource-name"
+
+	// maxRenderIterations is the maximum number of times the function is run
+	// for a single step, until the extra resource requirements are satisfied.
+	maxRenderIterations = 5
+)
+
+// RenderCmd runs the function locally, without Crossplane or Docker.
+type RenderCmd struct {
+	FunctionFlags `embed:""`
+
+	CompositeResource string `arg:"" optional:"" help:"A YAML file with the composite resource (XR)." type:"existingfile"`
+	Composition       string `arg:"" optional:"" help:"A YAML file with the Composition. Only the pipeline steps calling the function are run." type:"existingfile"`
+
+	Request           string `short:"r" help:"A YAML or JSON file with the RunFunctionRequest, instead of the composite resource and the Composition." type:"existingfile"`
+	ObservedResources string `short:"o" help:"A YAML file with the observed composed resources, annotated with their names in the Composition (crossplane.io/composition-resource-name)." type:"existingfile"`
+	ExtraResources    string `short:"e" help:"A YAML file with the resources, which are supplied to the function, when it requires extra resources." type:"existingfile"`
+	FunctionName      string `help:"Name of the function in the Composition pipeline steps." default:"function-javascript"`
+}
+
+// Validate the command arguments.
+func (c *RenderCmd) Validate() error {
+	switch {
+	case c.Request != "" && (c.CompositeResource != "" || c.Composition != ""):
+		return errors.New("either --request, or the composite resource and the Composition must be specified, not both")
+	case c.Request == "" && (c.CompositeResource == "" || c.Composition == ""):
+		return errors.New("either --request, or the composite resource and the Composition must be specified")
+	}
+
+	return nil
+}
+
+// Run the function and print the response to the standard output.
+func (c *RenderCmd) Run() error {
+	log, err := function.NewLogger(c.Debug)
+	if err != nil {
+		return err
+	}
+
+	fn, err := c.newFunction(log)
+	if err != nil {
+		return err
+	}
+
+	// The response is printed to stdout, so the script logs are printed to stderr.
+	js.SetConsoleOutput(os.Stderr, os.Stderr)
+
+	return c.render(context.Background(), fn, os.Stdout)
+}
+
+func (c *RenderCmd) render(ctx context.Context, fn *Function, w io.Writer) error {
+	var extra []*unstructured.Unstructured
+	if c.ExtraResources != "" {
+		var err error
+		if extra, err = readObjects(c.ExtraResources); err != nil {
+			return errors.Wrap(err, "cannot read extra resources")
+		}
+	}
+
+	var (
+		rsp *fnv1.RunFunctionResponse
+		err error
+	)
+
+	if c.Request != "" {
+		rsp, err = c.renderRequest(ctx, fn, extra)
+	} else {
+		rsp, err = c.renderComposition(ctx, fn, extra)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	data, err := protojson.Marshal(rsp)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal the function response")
+	}
+
+	data, err = sigsyaml.JSONToYAML(data)
+	if err != nil {
+		return errors.Wrap(err, "cannot convert the function response to YAML")
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (c *RenderCmd) renderRequest(ctx context.Context, fn *Function, extra []*unstructured.Unstructured) (*fnv1.RunFunctionResponse, error) {
+	data, err := os.ReadFile(c.Request)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the function request")
+	}
+
+	data, err = sigsyaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse the function request")
+	}
+
+	req := &fnv1.RunFunctionRequest{}
+	if err := protojson.Unmarshal(data, req); err != nil {
+		return nil, errors.Wrap(err, "cannot parse the function request")
+	}
+
+	return runFunction(ctx, fn, req, extra)
+}
+
+// renderComposition runs the function for each Composition pipeline step
+// calling the function, like Crossplane does. The desired state and the
+// context returned by a step are passed to the next one. The pipeline steps
+// calling the other functions are skipped.
+func (c *RenderCmd) renderComposition(ctx context.Context, fn *Function, extra []*unstructured.Unstructured) (*fnv1.RunFunctionResponse, error) {
+	xrs, err := readObjects(c.CompositeResource)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the composite resource")
+	}
+	if len(xrs) != 1 {
+		return nil, errors.Errorf("expected exactly one composite resource, found %d", len(xrs))
+	}
+
+	comps, err := readObjects(c.Composition)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the Composition")
+	}
+	if len(comps) != 1 {
+		return nil, errors.Errorf("expected exactly one Composition, found %d", len(comps))
+	}
+
+	xr, err := structpb.NewStruct(xrs[0].Object)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot convert the composite resource")
+	}
+
+	observed := &fnv1.State{
+		Composite: &fnv1.Resource{Resource: xr},
+	}
+
+	if c.ObservedResources != "" {
+		if observed.Resources, err = readObservedResources(c.ObservedResources); err != nil {
+			return nil, errors.Wrap(err, "cannot read observed resources")
+		}
+	}
+
+	pipeline, _, err := unstructured.NestedSlice(comps[0].Object, "spec", "pipeline")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Composition pipeline")
+	}
+
+	out := &fnv1.RunFunctionResponse{
+		Desired: &fnv1.State{},
+	}
+
+	for i, s := range pipeline {
+		step, ok := s.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("invalid Composition pipeline step %d", i)
+		}
+
+		name, _, _ := unstructured.NestedString(step, "step")
+		fnName, _, _ := unstructured.NestedString(step, "functionRef", "name")
+		if fnName != c.FunctionName {
+			fn.log.Info("Skipping the pipeline step calling another function", "step", name, "function", fnName)
+			continue
+		}
+
+		input, _, err := unstructured.NestedMap(step, "input")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid input of the pipeline step %q", name)
+		}
+
+		in, err := structpb.NewStruct(input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid input of the pipeline step %q", name)
+		}
+
+		req := &fnv1.RunFunctionRequest{
+			Meta:     &fnv1.RequestMeta{Tag: name},
+			Observed: observed,
+			Desired:  out.Desired,
+			Context:  out.Context,
+			Input:    in,
+		}
+
+		rsp, err := runFunction(ctx, fn, req, extra)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot run the pipeline step %q", name)
+		}
+
+		out.Meta = rsp.GetMeta()
+		out.Desired = rsp.GetDesired()
+		out.Context = rsp.GetContext()
+		out.Requirements = rsp.GetRequirements()
+		out.Results = append(out.Results, rsp.GetResults()...)
+
+		if hasFatalResult(rsp) {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// runFunction runs the function, and then runs it again with the extra
+// resources it requires, until the requirements are stable.
+func runFunction(ctx context.Context, fn *Function, req *fnv1.RunFunctionRequest, extra []*unstructured.Unstructured) (*fnv1.RunFunctionResponse, error) {
+	var requirements *fnv1.Requirements
+
+	for i := 0; i < maxRenderIterations; i++ {
+		rsp, err := fn.RunFunction(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if proto.Equal(rsp.GetRequirements(), requirements) {
+			return rsp, nil
+		}
+
+		requirements = rsp.GetRequirements()
+
+		req = proto.Clone(req).(*fnv1.RunFunctionRequest)
+		if req.ExtraResources, err = selectExtraResources(requirements, extra); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errors.Errorf("the extra resource requirements didn't stabilize after %d runs", maxRenderIterations)
+}
+
+// selectExtraResources returns the extra resources matching the requirements.
+func selectExtraResources(requirements *fnv1.Requirements, extra []*unstructured.Unstructured) (map[string]*fnv1.Resources, error) {
+	resources := make(map[string]*fnv1.Resources, len(requirements.GetExtraResources()))
+
+	for name, selector := range requirements.GetExtraResources() {
+		items := &fnv1.Resources{}
+
+		for _, obj := range extra {
+			if !matchesSelector(obj, selector) {
+				continue
+			}
+
+			s, err := structpb.NewStruct(obj.Object)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot convert extra resource %s %q", obj.GetKind(), obj.GetName())
+			}
+			items.Items = append(items.Items, &fnv1.Resource{Resource: s})
+		}
+
+		resources[name] = items
+	}
+
+	return resources, nil
+}
+
+func matchesSelector(obj *unstructured.Unstructured, selector *fnv1.ResourceSelector) bool {
+	if obj.GetAPIVersion() != selector.GetApiVersion() || obj.GetKind() != selector.GetKind() {
+		return false
+	}
+
+	switch match := selector.GetMatch().(type) {
+	case *fnv1.ResourceSelector_MatchName:
+		return obj.GetName() == match.MatchName
+	case *fnv1.ResourceSelector_MatchLabels:
+		return labels.SelectorFromSet(match.MatchLabels.GetLabels()).Matches(labels.Set(obj.GetLabels()))
+	default:
+		return false
+	}
+}
+
+func hasFatalResult(rsp *fnv1.RunFunctionResponse) bool {
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readObservedResources reads the observed composed resources, named by the
+// composition resource name annotation.
+func readObservedResources(path string) (map[string]*fnv1.Resource, error) {
+	objs, err := readObjects(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make(map[string]*fnv1.Resource, len(objs))
+	for _, obj := range objs {
+		name := obj.GetAnnotations()[AnnotationCompositionResourceName]
+		if name == "" {
+			return nil, errors.Errorf("%s %q must have the %s annotation", obj.GetKind(), obj.GetName(), AnnotationCompositionResourceName)
+		}
+
+		s, err := structpb.NewStruct(obj.Object)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot convert %s %q", obj.GetKind(), obj.GetName())
+		}
+		resources[name] = &fnv1.Resource{Resource: s}
+	}
+
+	return resources, nil
+}
+
+// readObjects reads the objects from the YAML or JSON file. YAML files can
+// contain multiple documents.
+func readObjects(path string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+
+	d := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := make(map[string]any)
+		if err := d.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, errors.Wrapf(err, "cannot parse %s", path)
+		}
+
+		if len(obj) > 0 {
+			objs = append(objs, &unstructured.Unstructured{Object: obj})
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/salemove/crossplane-function-javascript/internal/js"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+func TestRender(t *testing.T) {
+	type want struct {
+		rsp *fnv1.RunFunctionResponse
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		cmd    RenderCmd
+		want   want
+	}{
+		"Request": {
+			reason: "The render command should run the function against the request",
+			cmd: RenderCmd{
+				Request: "testdata/render/request.yaml",
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "example", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"region":"us-east-1"}}`),
+						},
+					},
+				},
+			},
+		},
+		"Composition": {
+			reason: "The render command should run the pipeline steps calling the function with the required extra resources",
+			cmd: RenderCmd{
+				CompositeResource: "testdata/render/xr.yaml",
+				Composition:       "testdata/render/composition.yaml",
+				ObservedResources: "testdata/render/observed.yaml",
+				ExtraResources:    "testdata/render/extra.yaml",
+				FunctionName:      "function-javascript",
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "update-status", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{"status":{"bucketArn":"arn:aws:s3:::example-bucket"}}`),
+						},
+						Resources: map[string]*fnv1.Resource{
+							"bucket": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion":"example.org/v1",
+									"kind":"Bucket",
+									"spec":{"forProvider":{"region":"us-east-1","acl":"private"}}
+								}`),
+							},
+						},
+					},
+					Context: &structpb.Struct{
+						Fields: map[string]*structpb.Value{
+							"example.org/bucket": structpb.NewStringValue("bucket"),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "bucket bucket rendered",
+						},
+					},
+				},
+			},
+		},
+		"MissingObservedResourceName": {
+			reason: "The render command should return an error if an observed resource isn't named",
+			cmd: RenderCmd{
+				CompositeResource: "testdata/render/xr.yaml",
+				Composition:       "testdata/render/composition.yaml",
+				ObservedResources: "testdata/render/extra.yaml",
+				FunctionName:      "function-javascript",
+			},
+			want: want{
+				err: true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{
+				log:      logging.NewNopLogger(),
+				programs: js.NewProgramCache(10),
+				runtimes: js.NewPool(1),
+			}
+
+			var out bytes.Buffer
+			err := tc.cmd.render(context.Background(), f, &out)
+
+			if tc.want.err {
+				if err == nil {
+					t.Errorf("%s\ncmd.render(...): expected error, got nil", tc.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s\ncmd.render(...): unexpected error: %v", tc.reason, err)
+			}
+
+			data, err := yaml.YAMLToJSON(out.Bytes())
+			if err != nil {
+				t.Fatalf("%s\ncmd.render(...): invalid YAML output: %v", tc.reason, err)
+			}
+
+			rsp := &fnv1.RunFunctionResponse{}
+			if err := protojson.Unmarshal(data, rsp); err != nil {
+				t.Fatalf("%s\ncmd.render(...): invalid response: %v", tc.reason, err)
+			}
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\ncmd.render(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
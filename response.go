@@ -2,12 +2,21 @@ package main
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
 
 	"dario.cat/mergo"
+	"github.com/dop251/goja"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	fncontext "github.com/crossplane/function-sdk-go/context"
 	"github.com/crossplane/function-sdk-go/errors"
-	fnv1beta1 "github.com/crossplane/function-sdk-go/proto/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
 	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/response"
@@ -15,7 +24,14 @@ import (
 
 type Response struct {
 	desiredComposite *resource.Composite
+	compositeReady   resource.Ready
 	desiredComposed  map[resource.Name]*resource.DesiredComposed
+	observedComposed map[resource.Name]resource.ObservedComposed
+	readinessChecks  map[resource.Name][]ReadinessCheck
+	results          []*fnv1.Result
+	context          map[string]any
+	requirements     map[string]*fnv1.ResourceSelector
+	ttl              *time.Duration
 }
 
 const (
@@ -24,7 +40,7 @@ const (
 
 // NewResponse creates a Response object passed as a second argument to the
 // JavaScript handler function.
-func NewResponse(req *fnv1beta1.RunFunctionRequest) (*Response, error) {
+func NewResponse(req *fnv1.RunFunctionRequest) (*Response, error) {
 	desiredCompositeResource, err := request.GetDesiredCompositeResource(req)
 	if err != nil {
 		return nil, err
@@ -35,9 +51,19 @@ func NewResponse(req *fnv1beta1.RunFunctionRequest) (*Response, error) {
 		return nil, err
 	}
 
+	observedComposedResources, err := request.GetObservedComposedResources(req)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Response{
 		desiredComposite: desiredCompositeResource,
+		compositeReady:   readyFromProto(req.GetDesired().GetComposite().GetReady()),
 		desiredComposed:  desiredComposedResources,
+		observedComposed: observedComposedResources,
+		readinessChecks:  make(map[resource.Name][]ReadinessCheck),
+		context:          req.GetContext().AsMap(),
+		requirements:     make(map[string]*fnv1.ResourceSelector),
 	}, nil
 }
 
@@ -45,13 +71,181 @@ func NewResponse(req *fnv1beta1.RunFunctionRequest) (*Response, error) {
 // function response. The caller must be sure to avoid overwriting the desired
 // state that may have been accumulated by previous Functions in the pipeline,
 // unless they intend to.
-func (r *Response) SetDesiredComposedResource(name string, obj map[string]any) error {
+//
+// The optional options object can set the resource readiness, e.g. {ready: true}.
+func (r *Response) SetDesiredComposedResource(name string, obj map[string]any, opts ...map[string]any) error {
+	var ready *resource.Ready
+
+	for _, o := range opts {
+		if val, ok := o["ready"]; ok {
+			parsed, err := parseReadyOption(val)
+			if err != nil {
+				return errors.Wrapf(err, `invalid resource "%s"`, name)
+			}
+			ready = &parsed
+		}
+	}
+
+	if err := r.setDesiredComposedResource(name, obj, resource.ReadyUnspecified); err != nil {
+		return err
+	}
+
+	// The readiness option takes precedence over the annotation.
+	if ready != nil {
+		r.desiredComposed[resource.Name(name)].Ready = *ready
+	}
+
+	return nil
+}
+
+// SetReady sets the readiness ("True", "False" or "Unspecified") of the
+// existing desired composed resource.
+func (r *Response) SetReady(name string, ready string) error {
+	cur, ok := r.desiredComposed[resource.Name(name)]
+	if !ok {
+		return errors.Errorf(`cannot set readiness of resource "%s": resource not found`, name)
+	}
+
+	val, err := parseReady(ready)
+	if err != nil {
+		return errors.Wrapf(err, `cannot set readiness of resource "%s"`, name)
+	}
+
+	cur.Ready = val
+
+	return nil
+}
+
+// SetReadinessChecks sets the readiness checks of the desired composed
+// resource. When the function returns, the resource is marked as ready, if
+// the observed resource passes all the checks, and not ready otherwise.
+// The checks take precedence over the readiness set explicitly.
+func (r *Response) SetReadinessChecks(name string, checks []any) error {
+	var rc []ReadinessCheck
+	if err := convertViaJSON(checks, &rc); err != nil {
+		return errors.Wrapf(err, `invalid readiness checks of resource "%s"`, name)
+	}
+
+	for i := range rc {
+		if err := rc[i].Validate(); err != nil {
+			return errors.Wrapf(err, `invalid readiness check %d of resource "%s"`, i, name)
+		}
+	}
+
+	r.readinessChecks[resource.Name(name)] = rc
+
+	return nil
+}
+
+// PropagateConnectionDetails copies the connection details of the observed
+// composed resource to the desired composite resource. The keys are either
+// a list of the connection details keys, or a map of the composite resource
+// keys to the composed resource keys. The keys missing in the observed
+// resource, e.g. because it isn't created yet, are skipped.
+func (r *Response) PropagateConnectionDetails(name string, keys any) error {
+	mapping := make(map[string]string)
+
+	switch k := keys.(type) {
+	case []any:
+		for _, key := range k {
+			s, ok := key.(string)
+			if !ok {
+				return errors.Errorf(`invalid connection details keys of resource "%s": expected a string, got %T`, name, key)
+			}
+			mapping[s] = s
+		}
+	case map[string]any:
+		for to, from := range k {
+			s, ok := from.(string)
+			if !ok {
+				return errors.Errorf(`invalid connection details keys of resource "%s": expected a string value of "%s", got %T`, name, to, from)
+			}
+			mapping[to] = s
+		}
+	default:
+		return errors.Errorf(`invalid connection details keys of resource "%s": expected an array or an object, got %T`, name, keys)
+	}
+
+	observed, ok := r.observedComposed[resource.Name(name)]
+	if !ok {
+		return nil
+	}
+
+	for to, from := range mapping {
+		if val, ok := observed.ConnectionDetails[from]; ok {
+			r.desiredComposite.ConnectionDetails[to] = val
+		}
+	}
+
+	return nil
+}
+
+// MergeDesiredComposedResource deep merges the partial object into the desired
+// composed resource, keeping the fields set by the previous functions in the
+// pipeline. In case of conflict, new values have priority over existing ones.
+// Arrays are replaced. If the resource doesn't exist, it is created.
+func (r *Response) MergeDesiredComposedResource(name string, partial map[string]any) error {
+	dst := make(map[string]any)
+	ready := resource.ReadyUnspecified
+
+	if cur, ok := r.desiredComposed[resource.Name(name)]; ok {
+		dst = cur.Resource.DeepCopy().Object
+		ready = cur.Ready
+	}
+
+	if err := mergo.Merge(&dst, partial, mergo.WithOverride); err != nil {
+		return errors.Wrapf(err, `cannot merge resource "%s"`, name)
+	}
+
+	return r.setDesiredComposedResource(name, dst, ready)
+}
+
+// PatchDesiredComposedResource applies the JSON patch (RFC 6902) operations
+// to the existing desired composed resource.
+func (r *Response) PatchDesiredComposedResource(name string, ops []any) error {
+	cur, ok := r.desiredComposed[resource.Name(name)]
+	if !ok {
+		return errors.Errorf(`cannot patch resource "%s": resource not found`, name)
+	}
+
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return errors.Wrapf(err, `cannot marshal patch for resource "%s"`, name)
+	}
+
+	patch, err := jsonpatch.DecodePatch(data)
+	if err != nil {
+		return errors.Wrapf(err, `invalid patch for resource "%s"`, name)
+	}
+
+	doc, err := json.Marshal(cur.Resource.Object)
+	if err != nil {
+		return errors.Wrapf(err, `cannot marshal resource "%s"`, name)
+	}
+
+	doc, err = patch.Apply(doc)
+	if err != nil {
+		return errors.Wrapf(err, `cannot patch resource "%s"`, name)
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return errors.Wrapf(err, `cannot unmarshal patched resource "%s"`, name)
+	}
+
+	return r.setDesiredComposedResource(name, obj, cur.Ready)
+}
+
+// setDesiredComposedResource validates and sets the desired composed resource
+// with the specified readiness, unless it is overridden by the annotation.
+func (r *Response) setDesiredComposedResource(name string, obj map[string]any, ready resource.Ready) error {
 	if obj == nil {
 		return errors.Errorf(`invalid resource "%s": expected a non-nil Object`, name)
 	}
 
 	res := resource.NewDesiredComposed()
 	res.Resource.Object = obj
+	res.Ready = ready
 
 	if res.Resource.GetAPIVersion() == "" {
 		return errors.Errorf(`invalid resource "%s": APIVersion must be set`, name)
@@ -65,14 +259,11 @@ func (r *Response) SetDesiredComposedResource(name string, obj map[string]any) e
 
 	if annotations != nil {
 		if val, ok := annotations[AnnotationReadyKey]; ok {
-			val := resource.Ready(val)
-
-			switch val {
-			case resource.ReadyTrue, resource.ReadyFalse, resource.ReadyUnspecified:
-				res.Ready = val
-			default:
-				res.Ready = resource.ReadyUnspecified
+			ready, err := parseReady(val)
+			if err != nil {
+				return errors.Wrapf(err, `invalid resource "%s": invalid %s annotation`, name, AnnotationReadyKey)
 			}
+			res.Ready = ready
 
 			delete(annotations, AnnotationReadyKey)
 			res.Resource.SetAnnotations(annotations)
@@ -84,35 +275,307 @@ func (r *Response) SetDesiredComposedResource(name string, obj map[string]any) e
 	return nil
 }
 
+// GetDesiredComposedResource returns a copy of the desired composed resource
+// accumulated by the previous functions in the pipeline or set by the script,
+// or nil if the resource doesn't exist. Changes to the returned object don't
+// affect the desired state, use SetDesiredComposedResource to apply them.
+func (r *Response) GetDesiredComposedResource(name string) map[string]any {
+	res, ok := r.desiredComposed[resource.Name(name)]
+	if !ok {
+		return nil
+	}
+
+	return res.Resource.DeepCopy().Object
+}
+
+// ListDesiredComposedResources returns the sorted names of the desired
+// composed resources.
+func (r *Response) ListDesiredComposedResources() []string {
+	names := make([]string, 0, len(r.desiredComposed))
+	for name := range r.desiredComposed {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// DeleteDesiredComposedResource deletes the desired composed resource from
+// the function response, so Crossplane deletes the composed resource.
+func (r *Response) DeleteDesiredComposedResource(name string) {
+	delete(r.desiredComposed, resource.Name(name))
+}
+
 // UpdateCompositeStatus merges the desired composite resource status in the
 // function response. In case of conflict, new values have priority over existing ones.
 func (r *Response) UpdateCompositeStatus(status map[string]any) error {
+	return r.MergeCompositeStatus("", status)
+}
+
+// SetCompositeStatus replaces the desired composite resource status field at
+// the path (e.g. "network.vpc"), or the whole status if the path is empty.
+// The field is deleted, if the value is null.
+func (r *Response) SetCompositeStatus(path string, value any) error {
+	path = statusPath(path)
+
+	if value == nil {
+		if err := fieldpath.Pave(r.desiredComposite.Resource.Object).DeleteField(path); err != nil {
+			return errors.Wrapf(err, "cannot delete desired composite %s", path)
+		}
+		return nil
+	}
+
+	if err := r.desiredComposite.Resource.SetValue(path, value); err != nil {
+		return errors.Wrapf(err, "cannot set desired composite %s", path)
+	}
+
+	return nil
+}
+
+// MergeCompositeStatus merges the value into the desired composite resource
+// status field at the path (e.g. "network.vpc"), or into the whole status if
+// the path is empty. In case of conflict, new values have priority over existing ones.
+func (r *Response) MergeCompositeStatus(path string, value map[string]any) error {
+	path = statusPath(path)
+
 	dst := make(map[string]interface{})
-	if err := r.desiredComposite.Resource.GetValueInto("status", &dst); err != nil && !fieldpath.IsNotFound(err) {
-		return errors.Wrap(err, "cannot get desired composite status")
+	if err := r.desiredComposite.Resource.GetValueInto(path, &dst); err != nil && !fieldpath.IsNotFound(err) {
+		return errors.Wrapf(err, "cannot get desired composite %s", path)
 	}
 
-	if err := mergo.Merge(&dst, status, mergo.WithOverride); err != nil {
-		return errors.Wrap(err, "cannot merge desired composite status")
+	if err := mergo.Merge(&dst, value, mergo.WithOverride); err != nil {
+		return errors.Wrapf(err, "cannot merge desired composite %s", path)
 	}
 
-	if err := r.desiredComposite.Resource.SetValue("status", dst); err != nil {
-		return errors.Wrap(err, "cannot set desired composite status")
+	if err := r.desiredComposite.Resource.SetValue(path, dst); err != nil {
+		return errors.Wrapf(err, "cannot set desired composite %s", path)
 	}
 
 	return nil
 }
 
-// SetConnectionDetails sets the desired composite resource connection details
-// in the function response.
-func (r *Response) SetConnectionDetails(details map[string]string) {
-	for key, val := range details {
-		decoded, _ := base64.StdEncoding.DecodeString(val)
-		r.desiredComposite.ConnectionDetails[key] = decoded
+// SetCompositeLabels sets the desired composite resource labels. Existing
+// labels are kept, unless they are overwritten. Labels with null values are deleted.
+func (r *Response) SetCompositeLabels(labels map[string]any) error {
+	merged, err := mergeStringMap(r.desiredComposite.Resource.GetLabels(), labels)
+	if err != nil {
+		return errors.Wrap(err, "invalid desired composite labels")
 	}
+
+	r.desiredComposite.Resource.SetLabels(merged)
+
+	return nil
 }
 
-func (r *Response) setFunctionResponse(rsp *fnv1beta1.RunFunctionResponse) error {
+// SetCompositeAnnotations sets the desired composite resource annotations. Existing
+// annotations are kept, unless they are overwritten. Annotations with null values are deleted.
+func (r *Response) SetCompositeAnnotations(annotations map[string]any) error {
+	merged, err := mergeStringMap(r.desiredComposite.Resource.GetAnnotations(), annotations)
+	if err != nil {
+		return errors.Wrap(err, "invalid desired composite annotations")
+	}
+
+	r.desiredComposite.Resource.SetAnnotations(merged)
+
+	return nil
+}
+
+// SetCompositeReady explicitly sets the desired composite resource readiness
+// ("True", "False" or "Unspecified").
+func (r *Response) SetCompositeReady(ready string) error {
+	val, err := parseReady(ready)
+	if err != nil {
+		return errors.Wrap(err, "invalid desired composite readiness")
+	}
+
+	r.compositeReady = val
+
+	return nil
+}
+
+// Connection details encodings.
+const (
+	EncodingBase64 = "base64"
+	EncodingPlain  = "plain"
+)
+
+// SetConnectionDetails sets the desired composite resource connection details.
+// String values are Base64-encoded by default, the optional options object can
+// set the encoding of the strings, e.g. {encoding: 'plain'}. Binary values
+// (Uint8Array or ArrayBuffer) are set as is.
+func (r *Response) SetConnectionDetails(details map[string]any, opts ...map[string]any) error {
+	encoding := EncodingBase64
+
+	for _, o := range opts {
+		if val, ok := o["encoding"]; ok {
+			enc, _ := val.(string)
+			if enc != EncodingBase64 && enc != EncodingPlain {
+				return errors.Errorf(`invalid connection details encoding "%v", expected one of: %s, %s`, val, EncodingBase64, EncodingPlain)
+			}
+			encoding = enc
+		}
+	}
+
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Decode all the values first, so the connection details aren't partially set.
+	decoded := make(map[string][]byte, len(details))
+	for _, key := range keys {
+		switch val := details[key].(type) {
+		case string:
+			if encoding == EncodingPlain {
+				decoded[key] = []byte(val)
+				continue
+			}
+
+			data, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return errors.Wrapf(err, `invalid connection details "%s": cannot decode Base64 value`, key)
+			}
+			decoded[key] = data
+		case []byte:
+			// The slice is backed by the JavaScript runtime memory, which is reused.
+			decoded[key] = append([]byte(nil), val...)
+		case goja.ArrayBuffer:
+			decoded[key] = append([]byte(nil), val.Bytes()...)
+		default:
+			return errors.Errorf(`invalid connection details "%s": expected a string or binary value, got %T`, key, val)
+		}
+	}
+
+	for key, val := range decoded {
+		r.desiredComposite.ConnectionDetails[key] = val
+	}
+
+	return nil
+}
+
+// SetTTL sets the duration in seconds for which the function response can be
+// cached. Crossplane runs the function again at the latest when the TTL expires.
+func (r *Response) SetTTL(seconds float64) error {
+	if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return errors.Errorf("invalid TTL %v: must be a non-negative number of seconds", seconds)
+	}
+
+	ttl := time.Duration(seconds * float64(time.Second))
+	r.ttl = &ttl
+
+	return nil
+}
+
+// SetContext sets the key in the function pipeline context, so the value is
+// available to the next functions in the pipeline.
+func (r *Response) SetContext(key string, value any) {
+	r.context[key] = value
+}
+
+// MergeEnvironment merges the values into the Composition environment stored in
+// the function pipeline context. In case of conflict, new values have priority
+// over existing ones.
+func (r *Response) MergeEnvironment(values map[string]any) error {
+	env := map[string]any{
+		"apiVersion": "internal.crossplane.io/v1alpha1",
+		"kind":       "Environment",
+	}
+
+	if cur, ok := r.context[fncontext.KeyEnvironment].(map[string]any); ok {
+		env = cur
+	}
+
+	if err := mergo.Merge(&env, values, mergo.WithOverride); err != nil {
+		return errors.Wrap(err, "cannot merge environment")
+	}
+
+	r.context[fncontext.KeyEnvironment] = env
+
+	return nil
+}
+
+// ResourceSelector selects the extra resources required by the function.
+type ResourceSelector struct {
+	APIVersion  string            `json:"apiVersion"`
+	Kind        string            `json:"kind"`
+	MatchName   string            `json:"matchName,omitempty"`
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+// RequireResources requests the extra resources matching the selector from
+// Crossplane. Crossplane calls the function again with the matching resources
+// available in the request under the same name.
+func (r *Response) RequireResources(name string, selector map[string]any) error {
+	var sel ResourceSelector
+	if err := convertViaJSON(selector, &sel); err != nil {
+		return errors.Wrapf(err, `invalid resource selector "%s"`, name)
+	}
+
+	if sel.APIVersion == "" || sel.Kind == "" {
+		return errors.Errorf(`invalid resource selector "%s": apiVersion and kind must be set`, name)
+	}
+
+	rs := &fnv1.ResourceSelector{
+		ApiVersion: sel.APIVersion,
+		Kind:       sel.Kind,
+	}
+
+	switch {
+	case sel.MatchName != "" && len(sel.MatchLabels) > 0:
+		return errors.Errorf(`invalid resource selector "%s": only one of matchName or matchLabels must be set`, name)
+	case sel.MatchName != "":
+		rs.Match = &fnv1.ResourceSelector_MatchName{MatchName: sel.MatchName}
+	case len(sel.MatchLabels) > 0:
+		rs.Match = &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{Labels: sel.MatchLabels}}
+	default:
+		return errors.Errorf(`invalid resource selector "%s": matchName or matchLabels must be set`, name)
+	}
+
+	r.requirements[name] = rs
+
+	return nil
+}
+
+// Normal adds a normal result to the function response. Normal results are
+// emitted as normal events on the composite resource.
+func (r *Response) Normal(message string) {
+	r.addResult(fnv1.Severity_SEVERITY_NORMAL, message)
+}
+
+// Warning adds a warning result to the function response. Warning results are
+// emitted as warning events on the composite resource.
+func (r *Response) Warning(message string) {
+	r.addResult(fnv1.Severity_SEVERITY_WARNING, message)
+}
+
+// Fatal adds a fatal result to the function response. A fatal result stops
+// the pipeline, and is reported as a composite resource condition.
+func (r *Response) Fatal(message string) {
+	r.addResult(fnv1.Severity_SEVERITY_FATAL, message)
+}
+
+func (r *Response) addResult(severity fnv1.Severity, message string) {
+	r.results = append(r.results, &fnv1.Result{
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+func (r *Response) setFunctionResponse(rsp *fnv1.RunFunctionResponse) error {
+	// The desired composed resources are copied from the request, drop them,
+	// so the resources deleted by the script aren't included in the response.
+	if rsp.GetDesired() != nil {
+		rsp.Desired.Resources = nil
+	}
+
+	for name, checks := range r.readinessChecks {
+		if desired, ok := r.desiredComposed[name]; ok {
+			observed, ok := r.observedComposed[name]
+			desired.Ready = checkReadiness(observed, ok, checks)
+		}
+	}
+
 	err := response.SetDesiredComposedResources(rsp, r.desiredComposed)
 	if err != nil {
 		return errors.Wrap(err, "cannot set desired composed resources")
@@ -122,6 +585,118 @@ func (r *Response) setFunctionResponse(rsp *fnv1beta1.RunFunctionResponse) error
 	if err != nil {
 		return errors.Wrap(err, "cannot set desired composite resource")
 	}
+	rsp.Desired.Composite.Ready = readyToProto(r.compositeReady)
+
+	for key, val := range r.context {
+		v, err := structpb.NewValue(val)
+		if err != nil {
+			return errors.Wrapf(err, "cannot set context key %q", key)
+		}
+		response.SetContextKey(rsp, key, v)
+	}
+
+	for name, selector := range r.requirements {
+		requireResource(rsp, name, selector)
+	}
+
+	if r.ttl != nil {
+		if rsp.Meta == nil {
+			rsp.Meta = &fnv1.ResponseMeta{}
+		}
+		rsp.Meta.Ttl = durationpb.New(*r.ttl)
+	}
+
+	rsp.Results = append(rsp.Results, r.results...)
 
 	return nil
 }
+
+// convertViaJSON converts the value into the target type using their JSON representation.
+func convertViaJSON(from any, into any) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, into)
+}
+
+func statusPath(path string) string {
+	if path == "" {
+		return "status"
+	}
+
+	return "status." + path
+}
+
+// mergeStringMap merges the values into the string map. Keys with nil values
+// are deleted from the map.
+func mergeStringMap(dst map[string]string, values map[string]any) (map[string]string, error) {
+	if dst == nil {
+		dst = make(map[string]string, len(values))
+	}
+
+	for key, val := range values {
+		switch v := val.(type) {
+		case nil:
+			delete(dst, key)
+		case string:
+			dst[key] = v
+		default:
+			return nil, errors.Errorf(`value of "%s" must be a string, got %T`, key, val)
+		}
+	}
+
+	return dst, nil
+}
+
+// parseReady parses the readiness value.
+func parseReady(val string) (resource.Ready, error) {
+	switch ready := resource.Ready(val); ready {
+	case resource.ReadyTrue, resource.ReadyFalse, resource.ReadyUnspecified:
+		return ready, nil
+	default:
+		return "", errors.Errorf(`invalid readiness value "%s", expected one of: %s, %s, %s`,
+			val, resource.ReadyTrue, resource.ReadyFalse, resource.ReadyUnspecified)
+	}
+}
+
+// parseReadyOption parses the readiness option, which is either a boolean or
+// a readiness value.
+func parseReadyOption(val any) (resource.Ready, error) {
+	switch v := val.(type) {
+	case bool:
+		if v {
+			return resource.ReadyTrue, nil
+		}
+		return resource.ReadyFalse, nil
+	case string:
+		return parseReady(v)
+	case nil:
+		return resource.ReadyUnspecified, nil
+	default:
+		return "", errors.Errorf("invalid readiness value of type %T, expected a boolean or a string", val)
+	}
+}
+
+func readyFromProto(ready fnv1.Ready) resource.Ready {
+	switch ready {
+	case fnv1.Ready_READY_TRUE:
+		return resource.ReadyTrue
+	case fnv1.Ready_READY_FALSE:
+		return resource.ReadyFalse
+	default:
+		return resource.ReadyUnspecified
+	}
+}
+
+func readyToProto(ready resource.Ready) fnv1.Ready {
+	switch ready {
+	case resource.ReadyTrue:
+		return fnv1.Ready_READY_TRUE
+	case resource.ReadyFalse:
+		return fnv1.Ready_READY_FALSE
+	default:
+		return fnv1.Ready_READY_UNSPECIFIED
+	}
+}
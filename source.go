@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/salemove/crossplane-function-javascript/input/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+)
+
+const (
+	// ExtraResourcesSourceKey is the key of the extra resource requirement
+	// under which the function requests the resource containing its source.
+	ExtraResourcesSourceKey = "javascript.fn.crossplane.io/source"
+
+	defaultConfigMapKey = "index.js"
+	defaultOCIPath      = "index.js"
+)
+
+// errSourceNotReady is returned when the function source is not available
+// yet, because Crossplane hasn't supplied the requested extra resources.
+var errSourceNotReady = errors.New("function source is not ready")
+
+// Source is the function source code loaded from the function input.
+type Source struct {
+	// Name of the script, used in stack traces.
+	Name string
+
+	// Code of the script.
+	Code string
+}
+
+// getSource loads the function source specified in the function input.
+// Sources, which are requested from Crossplane as extra resources, set
+// the requirements in the function response, and return errSourceNotReady
+// until Crossplane supplies the requested resources.
+func (f *Function) getSource(ctx context.Context, req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) (*Source, error) {
+	var (
+		src *Source
+		err error
+	)
+
+	switch in.Spec.Source.Type {
+	case "", v1beta1.SourceTypeInline:
+		src = &Source{Name: "<inline.js>", Code: in.Spec.Source.Inline}
+		if in.Spec.Source.Language == v1beta1.LanguageTypeScript {
+			src.Name = "<inline.ts>"
+		}
+	case v1beta1.SourceTypeConfigMap:
+		src, err = getConfigMapSource(req, in.Spec.Source.ConfigMap, rsp)
+	case v1beta1.SourceTypeFile:
+		src, err = f.getFileSource(in.Spec.Source.File)
+	case v1beta1.SourceTypeOCI:
+		src, err = f.getOCISource(ctx, in.Spec.Source.OCI)
+	default:
+		return nil, errors.Errorf("invalid function input: unsupported source type %q", in.Spec.Source.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	src.Code = strings.TrimSpace(src.Code)
+	if src.Code == "" {
+		return nil, errors.New("invalid function input: empty source")
+	}
+
+	return src, nil
+}
+
+func getConfigMapSource(req *fnv1.RunFunctionRequest, cm *v1beta1.ConfigMapSource, rsp *fnv1.RunFunctionResponse) (*Source, error) {
+	if cm == nil || len(cm.MatchLabels) == 0 {
+		return nil, errors.New("invalid function input: ConfigMap source requires matchLabels")
+	}
+
+	requireResource(rsp, ExtraResourcesSourceKey, &fnv1.ResourceSelector{
+		ApiVersion: "v1",
+		Kind:       "ConfigMap",
+		Match: &fnv1.ResourceSelector_MatchLabels{
+			MatchLabels: &fnv1.MatchLabels{Labels: cm.MatchLabels},
+		},
+	})
+
+	extra, err := request.GetExtraResources(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get extra resources")
+	}
+
+	items, ok := extra[ExtraResourcesSourceKey]
+	if !ok {
+		return nil, errSourceNotReady
+	}
+
+	switch len(items) {
+	case 0:
+		return nil, errors.New("cannot find the source ConfigMap matching the labels")
+	case 1:
+	default:
+		return nil, errors.Errorf("expected exactly one source ConfigMap matching the labels, found %d", len(items))
+	}
+
+	key := cm.Key
+	if key == "" {
+		key = defaultConfigMapKey
+	}
+
+	configMap := items[0].Resource
+	code, found, err := unstructured.NestedString(configMap.Object, "data", key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get key %q from ConfigMap %s/%s", key, configMap.GetNamespace(), configMap.GetName())
+	}
+	if !found {
+		return nil, errors.Errorf("key %q not found in ConfigMap %s/%s", key, configMap.GetNamespace(), configMap.GetName())
+	}
+
+	return &Source{Name: key, Code: code}, nil
+}
+
+func (f *Function) getFileSource(path string) (*Source, error) {
+	if path == "" {
+		return nil, errors.New("invalid function input: File source requires file")
+	}
+
+	if f.scripts == nil {
+		return nil, errors.New("cannot load the source file: the scripts directory is not configured")
+	}
+
+	code, err := f.scripts.Load(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load the source file")
+	}
+
+	return &Source{Name: path, Code: code}, nil
+}
+
+func (f *Function) getOCISource(ctx context.Context, oci *v1beta1.OCISource) (*Source, error) {
+	if oci == nil || oci.Reference == "" {
+		return nil, errors.New("invalid function input: OCI source requires reference")
+	}
+
+	if f.oci == nil {
+		return nil, errors.New("cannot load the source artifact: OCI sources are not enabled")
+	}
+
+	path := oci.Path
+	if path == "" {
+		path = defaultOCIPath
+	}
+
+	code, err := f.oci.Load(ctx, oci.Reference, path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load the source artifact")
+	}
+
+	return &Source{Name: path, Code: code}, nil
+}
+
+// requireResource adds the extra resource requirement to the function response.
+func requireResource(rsp *fnv1.RunFunctionResponse, name string, selector *fnv1.ResourceSelector) {
+	if rsp.Requirements == nil {
+		rsp.Requirements = &fnv1.Requirements{}
+	}
+
+	if rsp.Requirements.ExtraResources == nil {
+		rsp.Requirements.ExtraResources = make(map[string]*fnv1.ResourceSelector)
+	}
+
+	rsp.Requirements.ExtraResources[name] = selector
+}
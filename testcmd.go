@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/salemove/crossplane-function-javascript/internal/js"
+	"github.com/salemove/crossplane-function-javascript/internal/scripts"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/function-sdk-go"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// TestFixtureSuffix is the suffix of the test fixture files.
+const TestFixtureSuffix = ".test.yaml"
+
+// TestCmd runs the scripts against the test fixtures.
+type TestCmd struct {
+	FunctionFlags `embed:""`
+
+	Paths []string `arg:"" optional:"" help:"Test fixture files, or directories to search for *.test.yaml fixtures recursively. Defaults to the current directory." type:"path"`
+}
+
+// TestFixture is a test case of a script. The fixture files can contain
+// multiple YAML documents, each of them is a separate test case.
+type TestFixture struct {
+	// Name of the test case. Defaults to the index of the YAML document.
+	Name string `json:"name,omitempty"`
+
+	// Request is the RunFunctionRequest the script is run against. The
+	// function input is set from the Input field.
+	Request map[string]any `json:"request,omitempty"`
+
+	// Input is the spec of the function input. File sources are loaded
+	// relative to the fixture directory, unless --scripts-dir is set.
+	Input map[string]any `json:"input"`
+
+	// Expected fields of the RunFunctionResponse. Only the desired state,
+	// the results and the context specified in the fixture are compared.
+	Expected map[string]any `json:"expected"`
+}
+
+// Fields of the expected response compared by the test command.
+var testExpectedFields = []string{"desired", "results", "context"}
+
+// Run the tests and print the results to the standard output.
+func (c *TestCmd) Run() error {
+	log, err := function.NewLogger(c.Debug)
+	if err != nil {
+		return err
+	}
+
+	fn, err := c.newFunction(log)
+	if err != nil {
+		return err
+	}
+
+	// The test results are printed to stdout, so the script logs are printed to stderr.
+	js.SetConsoleOutput(os.Stderr, os.Stderr)
+
+	return c.test(context.Background(), fn, os.Stdout)
+}
+
+func (c *TestCmd) test(ctx context.Context, fn *Function, w io.Writer) error {
+	paths := c.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findTestFixtures(paths)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.Errorf("no %s fixtures found", TestFixtureSuffix)
+	}
+
+	var passed, failed int
+
+	for _, file := range files {
+		fixtures, err := readTestFixtures(file)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read test fixtures from %s", file)
+		}
+
+		// File sources are loaded relative to the fixture, unless the scripts directory is set explicitly.
+		f := *fn
+		if c.ScriptsDir == "" {
+			f.scripts = scripts.NewDir(filepath.Dir(file))
+		}
+
+		for _, fixture := range fixtures {
+			name := file + "/" + fixture.Name
+			start := time.Now()
+
+			diff, err := runTestFixture(ctx, &f, fixture)
+			elapsed := time.Since(start).Seconds()
+
+			switch {
+			case err != nil:
+				failed++
+				fmt.Fprintf(w, "--- FAIL: %s (%.2fs)\n    %s\n", name, elapsed, err)
+			case diff != "":
+				failed++
+				fmt.Fprintf(w, "--- FAIL: %s (%.2fs)\n%s", name, elapsed, indent(diff, "    "))
+			default:
+				passed++
+				fmt.Fprintf(w, "--- PASS: %s (%.2fs)\n", name, elapsed)
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL\t%d passed, %d failed\n", passed, failed)
+		return errors.Errorf("%d of %d tests failed", failed, passed+failed)
+	}
+
+	fmt.Fprintf(w, "ok\t%d passed\n", passed)
+
+	return nil
+}
+
+// runTestFixture runs the function against the fixture request, and returns
+// the difference between the expected and the actual response.
+func runTestFixture(ctx context.Context, fn *Function, fixture *TestFixture) (string, error) {
+	req := &fnv1.RunFunctionRequest{}
+	if err := unmarshalProto(fixture.Request, req); err != nil {
+		return "", errors.Wrap(err, "invalid request")
+	}
+
+	in, err := structpb.NewStruct(map[string]any{
+		"apiVersion": "javascript.fn.crossplane.io/v1beta1",
+		"kind":       "Input",
+		"spec":       fixture.Input,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "invalid input")
+	}
+	req.Input = in
+
+	expected := make(map[string]any)
+	for _, field := range testExpectedFields {
+		if val, ok := fixture.Expected[field]; ok {
+			expected[field] = val
+		}
+	}
+
+	want := &fnv1.RunFunctionResponse{}
+	if err := unmarshalProto(expected, want); err != nil {
+		return "", errors.Wrap(err, "invalid expected response")
+	}
+
+	rsp, err := fn.RunFunction(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the expected fields are compared.
+	got := &fnv1.RunFunctionResponse{}
+	if _, ok := expected["desired"]; ok {
+		got.Desired = rsp.GetDesired()
+	}
+	if _, ok := expected["results"]; ok {
+		got.Results = rsp.GetResults()
+	}
+	if _, ok := expected["context"]; ok {
+		got.Context = rsp.GetContext()
+	}
+
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		return fmt.Sprintf("-want rsp, +got rsp:\n%s", diff), nil
+	}
+
+	return "", nil
+}
+
+// findTestFixtures returns the sorted fixture files, found in the specified paths.
+func findTestFixtures(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), TestFixtureSuffix) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func readTestFixtures(path string) ([]*TestFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []*TestFixture
+
+	d := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for i := 0; ; i++ {
+		fixture := &TestFixture{}
+		if err := d.Decode(fixture); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fixtures, nil
+			}
+			return nil, err
+		}
+
+		if fixture.Input == nil && fixture.Request == nil && fixture.Expected == nil {
+			// Skip empty documents.
+			i--
+			continue
+		}
+
+		if fixture.Input == nil {
+			return nil, errors.Errorf("test fixture %d: input is required", i)
+		}
+
+		if fixture.Name == "" {
+			fixture.Name = fmt.Sprint(i)
+		}
+
+		fixtures = append(fixtures, fixture)
+	}
+}
+
+// unmarshalProto converts the plain map to the proto message.
+func unmarshalProto(from map[string]any, into proto.Message) error {
+	if from == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return protojson.Unmarshal(data, into)
+}
+
+func indent(s string, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/salemove/crossplane-function-javascript/internal/js"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+func TestTestCmd(t *testing.T) {
+	type want struct {
+		output []string
+		err    bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		paths  []string
+		want   want
+	}{
+		"Passing": {
+			reason: "The test command should pass the fixtures matching the function responses",
+			paths:  []string{"testdata/fixtures/passing"},
+			want: want{
+				output: []string{
+					"--- PASS: testdata/fixtures/passing/bucket.test.yaml/creates the bucket",
+					"--- PASS: testdata/fixtures/passing/bucket.test.yaml/requires the region",
+					"ok\t2 passed",
+				},
+			},
+		},
+		"Failing": {
+			reason: "The test command should report the differences from the expected responses",
+			paths:  []string{"testdata/fixtures"},
+			want: want{
+				output: []string{
+					"--- FAIL: testdata/fixtures/failing/status.test.yaml/updates the status",
+					"-want rsp, +got rsp:",
+					"FAIL\t2 passed, 1 failed",
+				},
+				err: true,
+			},
+		},
+		"NoFixtures": {
+			reason: "The test command should return an error if no fixtures are found",
+			paths:  []string{"testdata/scripts"},
+			want: want{
+				err: true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{
+				log:      logging.NewNopLogger(),
+				programs: js.NewProgramCache(10),
+				runtimes: js.NewPool(1),
+			}
+
+			var out bytes.Buffer
+			err := (&TestCmd{Paths: tc.paths}).test(context.Background(), f, &out)
+
+			if (err != nil) != tc.want.err {
+				t.Errorf("%s\ncmd.test(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+
+			for _, line := range tc.want.output {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("%s\ncmd.test(...): output doesn't contain %q:\n%s", tc.reason, line, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+export default (req, rsp) => {
+  const region = req.observed.composite.resource.spec.region;
+  if (!region) {
+    rsp.fatal('spec.region is required');
+    return;
+  }
+
+  rsp.setDesiredComposedResource('bucket', {
+    apiVersion: 'example.org/v1',
+    kind: 'Bucket',
+    spec: { forProvider: { region } },
+  }, { ready: true });
+  rsp.setContext('example.org/region', region);
+};
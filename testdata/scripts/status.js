@@ -0,0 +1,3 @@
+export default (req, rsp) => {
+  rsp.updateCompositeStatus({ source: 'file' });
+};